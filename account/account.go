@@ -0,0 +1,195 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package account
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NethServer/nethsecurity-api/authenticator"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/middleware"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/store"
+	"github.com/NethServer/nethsecurity-api/sudo"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// ChangePassword changes the password of the current user, other sessions are revoked and a new token
+// for the current session is returned
+func ChangePassword(c *gin.Context) {
+	// Extract claims from JWT
+	claims := jwt.ExtractClaims(c)
+	username := claims["id"].(string)
+	role, _ := claims["role"].(string)
+	jti, _ := claims["jti"].(string)
+
+	// passwords of users from identity providers are not managed here
+	if provider, _ := claims["provider"].(string); provider != "" {
+		c.JSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+			Code:    403,
+			Message: "password managed by identity provider " + provider,
+			Data:    nil,
+		}))
+		return
+	}
+
+	var jsonRequest struct {
+		OldPassword string `json:"old_password" structs:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" structs:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindBodyWith(&jsonRequest, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// refuse attempts of locked users and clients
+	if !methods.CheckAuthLockout(c, username) {
+		return
+	}
+
+	// check old password
+	if identity, err := methods.CheckAuthentication(username, jsonRequest.OldPassword); err != nil || identity.Backend != authenticator.BackendLocal {
+		methods.RegisterAuthFailure(username, c.ClientIP())
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    http.StatusBadRequest,
+			Message: "validation_failed",
+			Data: sudo.ValidationResponse{
+				Validation: sudo.ValidationBag{
+					Errors: []sudo.ValidationEntry{
+						{
+							Message:   "invalid_password",
+							Parameter: "old_password",
+							Value:     "",
+						},
+					},
+				},
+			},
+		}))
+		return
+	}
+	methods.RegisterAuthSuccess(username)
+
+	// check new password strength
+	if messages := methods.CheckPasswordPolicy(username, jsonRequest.OldPassword, jsonRequest.NewPassword); len(messages) > 0 {
+		entries := []sudo.ValidationEntry{}
+		for _, message := range messages {
+			entries = append(entries, sudo.ValidationEntry{
+				Message:   message,
+				Parameter: "new_password",
+				Value:     "",
+			})
+		}
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    http.StatusBadRequest,
+			Message: "validation_failed",
+			Data: sudo.ValidationResponse{
+				Validation: sudo.ValidationBag{Errors: entries},
+			},
+		}))
+		return
+	}
+
+	// change password
+	if err := methods.SetPassword(c.Request.Context(), username, jsonRequest.NewPassword); err != nil {
+		logs.Logs.Println("[ERR][AUTH] password change failed for user " + username + ": " + err.Error())
+		code := methods.UBusErrorStatus(err)
+		c.JSON(code, structs.Map(response.StatusBadRequest{
+			Code:    code,
+			Message: "password change failed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	if err := methods.SetPasswordChanged(username); err != nil {
+		logs.Logs.Println("[ERR][AUTH] cannot save password change time for user " + username + ": " + err.Error())
+	}
+
+	// revoke other sessions
+	records, err := store.Tokens.List(username)
+	if err != nil {
+		logs.Logs.Println("[ERR][AUTH] cannot list sessions of user " + username + ": " + err.Error())
+	}
+	for _, record := range records {
+		if record.ID != jti {
+			if err := store.Tokens.Delete(record.ID); err != nil {
+				logs.Logs.Println("[ERR][AUTH] cannot revoke session " + record.ID + " of user " + username + ": " + err.Error())
+			}
+		}
+	}
+
+	logs.Logs.Println("[INFO][AUTH] password changed for user " + username + " from " + c.ClientIP())
+
+	// new token for the current session, without password change restriction
+	token, _, err := middleware.GenerateToken(&models.UserAuthorizations{
+		Username: username,
+		Role:     role,
+		TokenID:  jti,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    http.StatusInternalServerError,
+			Message: "Impossible to generate token",
+		}))
+		return
+	}
+	methods.SetTokenValidation(username, token, c.ClientIP(), c.Request.UserAgent())
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "password changed",
+		Data:    gin.H{"token": token},
+	}))
+}
+
+// ExpirePassword forces a user to change password at next login
+func ExpirePassword(c *gin.Context) {
+	var jsonRequest struct {
+		Username string `json:"username" structs:"username" binding:"required"`
+	}
+	if err := c.ShouldBindBodyWith(&jsonRequest, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	if err := methods.ExpirePassword(jsonRequest.Username); err != nil {
+		if errors.Is(err, methods.ErrInvalidUsername) {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "request fields malformed",
+				Data:    err.Error(),
+			}))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "password expire error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	logs.Logs.Println("[INFO][AUTH] password of user " + jsonRequest.Username + " expired by user " + jwt.ExtractClaims(c)["id"].(string))
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "password expired",
+		Data:    nil,
+	}))
+}
@@ -0,0 +1,288 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// keys of the request context read by the audit middleware, set by handlers knowing more than the route
+const (
+	userKey   = "audit_user"
+	typeKey   = "audit_type"
+	targetKey = "audit_target"
+	statusKey = "audit_status"
+	itemsKey  = "audit_items"
+)
+
+// Item is the result of one of the operations of a request, like a call of a batch
+type Item struct {
+	Target string
+	Status int
+}
+
+// maxLineSize is the longest event read by Query
+const maxLineSize = 1024 * 1024
+
+var file *os.File
+var size int64
+
+// writeLock serializes writes, rotateLock keeps files from being renamed while they are queried
+var writeLock sync.Mutex
+var rotateLock sync.RWMutex
+
+// Init opens the audit file, AUDIT_FILE, creating its directory
+func Init() error {
+	if err := os.MkdirAll(filepath.Dir(configuration.Config.AuditFile), 0700); err != nil {
+		return err
+	}
+
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	return open()
+}
+
+// open appends to the audit file
+func open() error {
+	f, err := os.OpenFile(configuration.Config.AuditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	file = f
+	size = info.Size()
+	return nil
+}
+
+// rotatedFile returns the name of the n-th rotated file, the current one for 0
+func rotatedFile(n int) string {
+	if n == 0 {
+		return configuration.Config.AuditFile
+	}
+	return configuration.Config.AuditFile + "." + strconv.Itoa(n)
+}
+
+// rotate renames the current file to .1, shifting the older ones and removing the ones past AUDIT_MAX_FILES
+func rotate() error {
+	rotateLock.Lock()
+	defer rotateLock.Unlock()
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	file = nil
+
+	// with no rotated files the current one is removed
+	os.Remove(rotatedFile(configuration.Config.AuditMaxFiles))
+	for n := configuration.Config.AuditMaxFiles - 1; n >= 0; n-- {
+		if err := os.Rename(rotatedFile(n), rotatedFile(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return open()
+}
+
+// Record appends the event to the audit file, rotating it when AUDIT_MAX_SIZE is reached
+func Record(event models.AuditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		logs.Logs.Println("[ERR][AUDIT] cannot encode event: " + err.Error())
+		return
+	}
+	line = append(line, '\n')
+
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	// file is closed on shutdown, or by a failed rotation
+	if file == nil {
+		logs.Logs.Println("[ERR][AUDIT] audit file not open, event lost: " + string(line))
+		return
+	}
+
+	if size > 0 && size+int64(len(line)) > configuration.Config.AuditMaxSize*1024*1024 {
+		if err := rotate(); err != nil {
+			logs.Logs.Println("[ERR][AUDIT] audit file rotation failed: " + err.Error())
+			if file == nil {
+				return
+			}
+		}
+	}
+
+	n, err := file.Write(line)
+	size += int64(n)
+	if err != nil {
+		logs.Logs.Println("[ERR][AUDIT] cannot write event: " + err.Error())
+	}
+}
+
+// Close flushes the audit file to disk and closes it, later events are only logged
+func Close() error {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+
+	if file == nil {
+		return nil
+	}
+	err := file.Sync()
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	file = nil
+	return err
+}
+
+// match tells if the event satisfies the filter
+func match(event models.AuditEvent, filter models.AuditFilter) bool {
+	switch {
+	case filter.Type != "" && event.Type != filter.Type:
+		return false
+	case filter.User != "" && event.User != filter.User:
+		return false
+	case filter.IP != "" && event.IP != filter.IP:
+		return false
+	case filter.Result != "" && event.Result != filter.Result:
+		return false
+	case !filter.Since.IsZero() && event.Time.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && event.Time.After(filter.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns the events matching the filter, newest first, with the total number of matches
+func Query(filter models.AuditFilter) ([]models.AuditEvent, int, error) {
+	rotateLock.RLock()
+	defer rotateLock.RUnlock()
+
+	// read oldest file first
+	matches := []models.AuditEvent{}
+	for n := configuration.Config.AuditMaxFiles; n >= 0; n-- {
+		f, err := os.Open(rotatedFile(n))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			var event models.AuditEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				// skip lines truncated by a crash
+				continue
+			}
+			if match(event, filter) {
+				matches = append(matches, event)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return selectPage(matches, filter.Page, filter.PerPage), len(matches), nil
+}
+
+// selectPage returns the page of the events, newest first. Pages past the end are empty, the number
+// of skipped events is computed only for existing pages so it never overflows
+func selectPage(matches []models.AuditEvent, page int, perPage int) []models.AuditEvent {
+	events := []models.AuditEvent{}
+	if page < 1 || perPage < 1 {
+		return events
+	}
+	pages := len(matches) / perPage
+	if len(matches)%perPage != 0 {
+		pages++
+	}
+	if page > pages {
+		return events
+	}
+
+	end := len(matches) - (page-1)*perPage
+	start := end - perPage
+	if start < 0 {
+		start = 0
+	}
+	for i := end - 1; i >= start; i-- {
+		events = append(events, matches[i])
+	}
+	return events
+}
+
+// SetUser sets the user of the event, for requests without a token like login and logout
+func SetUser(c *gin.Context, user string) {
+	c.Set(userKey, user)
+}
+
+// SetType sets the type of the event, for routes recording different types
+func SetType(c *gin.Context, eventType string) {
+	c.Set(typeKey, eventType)
+}
+
+// SetTarget sets the object of the event, like the name of an uploaded file
+func SetTarget(c *gin.Context, target string) {
+	c.Set(targetKey, target)
+}
+
+// SetStatus sets the status code of the event, for responses not telling the result like redirects
+func SetStatus(c *gin.Context, status int) {
+	c.Set(statusKey, status)
+}
+
+// AddItem adds the result of one of the operations of the request, an event is recorded for each
+// item instead of one for the whole request
+func AddItem(c *gin.Context, target string, status int) {
+	c.Set(itemsKey, append(Items(c), Item{Target: target, Status: status}))
+}
+
+// User returns the user set by SetUser
+func User(c *gin.Context) string {
+	return c.GetString(userKey)
+}
+
+// Type returns the type set by SetType
+func Type(c *gin.Context) string {
+	return c.GetString(typeKey)
+}
+
+// Target returns the object set by SetTarget
+func Target(c *gin.Context) string {
+	return c.GetString(targetKey)
+}
+
+// Status returns the status code set by SetStatus, 0 if not set
+func Status(c *gin.Context) int {
+	return c.GetInt(statusKey)
+}
+
+// Items returns the results added by AddItem
+func Items(c *gin.Context) []Item {
+	items, _ := c.Value(itemsKey).([]Item)
+	return items
+}
@@ -0,0 +1,55 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package audit
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+func TestSelectPage(t *testing.T) {
+	// events are stored oldest first, targets 0 to 4
+	matches := []models.AuditEvent{}
+	for _, target := range []string{"0", "1", "2", "3", "4"} {
+		matches = append(matches, models.AuditEvent{Target: target})
+	}
+
+	tests := []struct {
+		name    string
+		page    int
+		perPage int
+		want    []string
+	}{
+		{"first page", 1, 2, []string{"4", "3"}},
+		{"second page", 2, 2, []string{"2", "1"}},
+		{"last partial page", 3, 2, []string{"0"}},
+		{"past the end", 4, 2, []string{}},
+		{"all", 1, 500, []string{"4", "3", "2", "1", "0"}},
+		{"huge page", math.MaxInt, 2, []string{}},
+		{"huge page and size", math.MaxInt, math.MaxInt, []string{}},
+		{"huge size", 1, math.MaxInt, []string{"4", "3", "2", "1", "0"}},
+		{"page zero", 0, 2, []string{}},
+		{"negative page", math.MinInt, 2, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, event := range selectPage(matches, tt.page, tt.perPage) {
+				got = append(got, event.Target)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := selectPage(nil, 1, 50); len(got) != 0 {
+		t.Fatalf("got %v from no events", got)
+	}
+}
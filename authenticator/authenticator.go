@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// backend names, used in AUTH_BACKENDS
+const (
+	BackendLocal  = "local"
+	BackendLDAP   = "ldap"
+	BackendRADIUS = "radius"
+)
+
+// ErrInvalidCredentials is returned by a backend that rejected the credentials, other errors mean the
+// backend could not be reached or is not configured
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator checks credentials against a backend and returns the identity of the user
+type Authenticator interface {
+	Authenticate(ctx context.Context, username string, password string) (models.AuthIdentity, error)
+}
+
+// Provider returns the provider claim of tokens issued to users of the backend, empty for local users
+func Provider(backend string) string {
+	if backend == BackendLocal {
+		return ""
+	}
+	return backend
+}
+
+// QualifiedUsername returns the username of a user of the backend. Users of directories are prefixed
+// with the backend name, e.g. ldap:alice, so they never match a local user with the same name
+func QualifiedUsername(backend string, username string) string {
+	if backend == BackendLocal {
+		return username
+	}
+	return backend + ":" + username
+}
+
+// splitUsername returns the backend and the name inside the directory of a qualified username, the
+// backend is empty for other names. System usernames cannot contain colons
+func splitUsername(username string) (string, string) {
+	if index := strings.Index(username, ":"); index > 0 {
+		switch username[:index] {
+		case BackendLDAP, BackendRADIUS:
+			return username[:index], username[index+1:]
+		}
+	}
+	return "", username
+}
+
+// backend returns the authenticator by name
+func backend(name string) (Authenticator, error) {
+	switch name {
+	case BackendLocal:
+		return &Local{}, nil
+	case BackendLDAP:
+		return &LDAP{}, nil
+	case BackendRADIUS:
+		return &RADIUS{}, nil
+	}
+	return nil, errors.New("unknown authentication backend " + name)
+}
+
+// Authenticate tries the backends of AUTH_BACKENDS in order, the first one accepting the credentials
+// wins. Backends rejecting the credentials or unreachable are skipped, so local users can log in when
+// the directory is down. Qualified usernames, e.g. ldap:alice, are checked only by their backend.
+// The identity has the qualified username
+func Authenticate(username string, password string) (models.AuthIdentity, error) {
+	if username == "" || password == "" {
+		return models.AuthIdentity{}, ErrInvalidCredentials
+	}
+	qualifiedBackend, username := splitUsername(username)
+	if username == "" {
+		return models.AuthIdentity{}, ErrInvalidCredentials
+	}
+
+	errs := []string{}
+	for _, name := range configuration.Config.AuthBackends {
+		name = strings.TrimSpace(name)
+		if qualifiedBackend != "" && name != qualifiedBackend {
+			continue
+		}
+		authenticator, err := backend(name)
+		if err != nil {
+			logs.Logs.Println("[ERR][AUTH] " + err.Error())
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(configuration.Config.AuthTimeout)*time.Second)
+		identity, err := authenticator.Authenticate(ctx, username, password)
+		cancel()
+		if err == nil {
+			identity.Backend = name
+			identity.Username = QualifiedUsername(name, username)
+			return identity, nil
+		}
+
+		if !errors.Is(err, ErrInvalidCredentials) {
+			logs.Logs.Println("[ERR][AUTH] authentication backend " + name + " unavailable: " + err.Error())
+		}
+		errs = append(errs, name+": "+err.Error())
+	}
+	if len(errs) == 0 {
+		return models.AuthIdentity{}, ErrInvalidCredentials
+	}
+	return models.AuthIdentity{}, errors.New(strings.Join(errs, ", "))
+}
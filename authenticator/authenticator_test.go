@@ -0,0 +1,187 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package authenticator
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2869"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+)
+
+const testSecret = "radius-secret"
+
+// radiusServer accepts alice with password "secret", in group fw-admins
+type radiusServer struct {
+	conn net.PacketConn
+
+	// how responses are signed: "valid", "missing" or "invalid" Message-Authenticator
+	signature atomic.Value
+	// requests without a valid Message-Authenticator
+	unsigned atomic.Int32
+}
+
+func newRADIUSServer(t *testing.T) *radiusServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &radiusServer{conn: conn}
+	server.signature.Store("valid")
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buffer := make([]byte, radius.MaxPacketLength)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			request, err := radius.Parse(buffer[:n], []byte(testSecret))
+			if err != nil {
+				continue
+			}
+
+			received, _ := rfc2869.MessageAuthenticator_Lookup(request)
+			expected, _ := messageAuthenticator(request, request.Authenticator)
+			if received == nil || !hmac.Equal(received, expected) || request.Attributes[0].Type != rfc2869.MessageAuthenticator_Type {
+				server.unsigned.Add(1)
+			}
+
+			code := radius.CodeAccessReject
+			if rfc2865.UserName_GetString(request) == "alice" && rfc2865.UserPassword_GetString(request) == "secret" {
+				code = radius.CodeAccessAccept
+			}
+			response := request.Response(code)
+			if code == radius.CodeAccessAccept {
+				_ = rfc2865.Class_Add(response, []byte("fw-admins"))
+			}
+
+			switch server.signature.Load() {
+			case "valid":
+				_ = rfc2869.MessageAuthenticator_Set(response, make([]byte, md5.Size))
+				signature, _ := messageAuthenticator(response, request.Authenticator)
+				_ = rfc2869.MessageAuthenticator_Set(response, signature)
+			case "invalid":
+				_ = rfc2869.MessageAuthenticator_Set(response, make([]byte, md5.Size))
+			}
+
+			wire, err := response.Encode()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(wire, addr)
+		}
+	}()
+	return server
+}
+
+func TestMain(m *testing.M) {
+	logs.Init("nethsecurity_api_test")
+	configuration.Config.AuthTimeout = 2
+	os.Exit(m.Run())
+}
+
+func TestQualifiedUsername(t *testing.T) {
+	tests := []struct {
+		backend  string
+		username string
+		want     string
+	}{
+		{BackendLocal, "alice", "alice"},
+		{BackendLDAP, "alice", "ldap:alice"},
+		{BackendRADIUS, "alice", "radius:alice"},
+		{BackendLDAP, "bob:smith", "ldap:bob:smith"},
+	}
+	for _, tt := range tests {
+		qualified := QualifiedUsername(tt.backend, tt.username)
+		if qualified != tt.want {
+			t.Errorf("QualifiedUsername(%q, %q) = %q, want %q", tt.backend, tt.username, qualified, tt.want)
+		}
+
+		// qualified names are split back to backend and name
+		backend, username := splitUsername(qualified)
+		if tt.backend == BackendLocal {
+			if backend != "" || username != tt.username {
+				t.Errorf("splitUsername(%q) = %q, %q", qualified, backend, username)
+			}
+		} else if backend != tt.backend || username != tt.username {
+			t.Errorf("splitUsername(%q) = %q, %q", qualified, backend, username)
+		}
+	}
+
+	// other prefixes are not backends
+	if backend, username := splitUsername("oidc:alice"); backend != "" || username != "oidc:alice" {
+		t.Errorf("splitUsername(oidc:alice) = %q, %q", backend, username)
+	}
+}
+
+func TestAuthenticateRADIUS(t *testing.T) {
+	server := newRADIUSServer(t)
+	configuration.Config.AuthBackends = []string{BackendRADIUS}
+	configuration.Config.RADIUSServer = server.conn.LocalAddr().String()
+	configuration.Config.RADIUSSecret = testSecret
+
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		signature string
+		backends  []string
+		want      string
+		invalid   bool
+		fail      string
+	}{
+		{name: "login", username: "alice", password: "secret", signature: "valid", want: "radius:alice"},
+		{name: "qualified name", username: "radius:alice", password: "secret", signature: "valid", want: "radius:alice"},
+		{name: "wrong password", username: "alice", password: "wrong", signature: "valid", fail: "invalid credentials"},
+		{name: "backend of other name", username: "ldap:alice", password: "secret", signature: "valid", invalid: true},
+		{name: "empty qualified name", username: "radius:", password: "secret", signature: "valid", invalid: true},
+		{name: "missing message authenticator", username: "alice", password: "secret", signature: "missing", fail: "without Message-Authenticator"},
+		{name: "invalid message authenticator", username: "alice", password: "secret", signature: "invalid", fail: "invalid Message-Authenticator"},
+		{name: "reject without message authenticator", username: "alice", password: "wrong", signature: "missing", fail: "without Message-Authenticator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.signature.Store(tt.signature)
+
+			identity, err := Authenticate(tt.username, tt.password)
+			switch {
+			case tt.invalid:
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("got %v, want ErrInvalidCredentials", err)
+				}
+			case tt.fail != "":
+				if err == nil || !strings.Contains(err.Error(), tt.fail) {
+					t.Fatalf("got %v, want error with %q", err, tt.fail)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if identity.Username != tt.want || identity.Backend != BackendRADIUS || !reflect.DeepEqual(identity.Groups, []string{"fw-admins"}) {
+					t.Fatalf("got %+v", identity)
+				}
+			}
+		})
+	}
+
+	if unsigned := server.unsigned.Load(); unsigned != 0 {
+		t.Fatalf("%d requests without a valid Message-Authenticator", unsigned)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package authenticator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// LDAP searches the user with the service account, or anonymously, and binds with its DN and password
+type LDAP struct{}
+
+// dial connects to LDAP_URL, upgrading the connection with StartTLS when configured
+func (LDAP) dial(ctx context.Context) (*ldap.Conn, error) {
+	timeout := time.Duration(configuration.Config.AuthTimeout) * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	conn, err := ldap.DialURL(configuration.Config.LDAPURL, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if configuration.Config.LDAPStartTLS {
+		parsed, err := url.Parse(configuration.Config.LDAPURL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: parsed.Hostname()}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (l LDAP) Authenticate(ctx context.Context, username string, password string) (models.AuthIdentity, error) {
+	if configuration.Config.LDAPURL == "" || configuration.Config.LDAPBaseDN == "" {
+		return models.AuthIdentity{}, errors.New("LDAP_URL and LDAP_BASE_DN are not set")
+	}
+
+	// an empty password is an anonymous bind, accepted by many servers
+	if password == "" {
+		return models.AuthIdentity{}, ErrInvalidCredentials
+	}
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return models.AuthIdentity{}, err
+	}
+	defer conn.Close()
+
+	// bind with service account to search users
+	if configuration.Config.LDAPBindDN != "" {
+		if err := conn.Bind(configuration.Config.LDAPBindDN, configuration.Config.LDAPBindPassword); err != nil {
+			return models.AuthIdentity{}, fmt.Errorf("service account bind failed: %w", err)
+		}
+	}
+
+	// search user, a single entry must match
+	result, err := conn.Search(ldap.NewSearchRequest(
+		configuration.Config.LDAPBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(configuration.Config.LDAPUserFilter, ldap.EscapeFilter(username)),
+		[]string{configuration.Config.LDAPGroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return models.AuthIdentity{}, err
+	}
+	if len(result.Entries) != 1 {
+		return models.AuthIdentity{}, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	// check password
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return models.AuthIdentity{}, ErrInvalidCredentials
+		}
+		return models.AuthIdentity{}, err
+	}
+
+	// groups can be mapped by DN or by name, e.g. cn=fw-admins,ou=groups,dc=example,dc=org or fw-admins
+	groups := []string{}
+	for _, group := range entry.GetAttributeValues(configuration.Config.LDAPGroupAttribute) {
+		groups = append(groups, group)
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			groups = append(groups, dn.RDNs[0].Attributes[0].Value)
+		}
+	}
+
+	return models.AuthIdentity{Username: username, Groups: groups}, nil
+}
@@ -0,0 +1,38 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package authenticator
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+// Local checks credentials of the system users with rpcd session login
+type Local struct{}
+
+func (Local) Authenticate(ctx context.Context, username string, password string) (models.AuthIdentity, error) {
+	// define login object
+	login := models.UserLogin{
+		Username: username,
+		Password: password,
+		Timeout:  1,
+	}
+
+	// execute login call on ubus, rpcd denies wrong credentials
+	if _, err := executor.Default.Call(ctx, "session", "login", login); err != nil {
+		var statusErr *ubus.StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == ubus.StatusPermissionDenied {
+			return models.AuthIdentity{}, ErrInvalidCredentials
+		}
+		return models.AuthIdentity{}, err
+	}
+
+	return models.AuthIdentity{Username: username}, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package authenticator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"errors"
+	"fmt"
+
+	"layeh.com/radius"
+	"layeh.com/radius/rfc2865"
+	"layeh.com/radius/rfc2869"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// RADIUS sends an Access-Request with PAP, groups are read from the Class and Filter-Id attributes
+// of the Access-Accept. Requests and responses are signed with Message-Authenticator, responses
+// without it are refused (BlastRADIUS)
+type RADIUS struct{}
+
+// messageAuthenticator returns the Message-Authenticator of the packet (RFC 2869), the HMAC-MD5 of the
+// packet with the attribute zeroed and, for responses, the authenticator of the request
+func messageAuthenticator(packet *radius.Packet, authenticator [16]byte) ([]byte, error) {
+	zeroed := *packet
+	zeroed.Authenticator = authenticator
+	zeroed.Attributes = append(radius.Attributes{}, packet.Attributes...)
+	if err := rfc2869.MessageAuthenticator_Set(&zeroed, make([]byte, md5.Size)); err != nil {
+		return nil, err
+	}
+	wire, err := zeroed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(md5.New, packet.Secret)
+	mac.Write(wire)
+	return mac.Sum(nil), nil
+}
+
+func (RADIUS) Authenticate(ctx context.Context, username string, password string) (models.AuthIdentity, error) {
+	if configuration.Config.RADIUSServer == "" || configuration.Config.RADIUSSecret == "" {
+		return models.AuthIdentity{}, errors.New("RADIUS_SERVER and RADIUS_SECRET are not set")
+	}
+
+	// create request, Message-Authenticator is the first attribute
+	packet := radius.New(radius.CodeAccessRequest, []byte(configuration.Config.RADIUSSecret))
+	if err := rfc2869.MessageAuthenticator_Set(packet, make([]byte, md5.Size)); err != nil {
+		return models.AuthIdentity{}, err
+	}
+	if err := rfc2865.UserName_SetString(packet, username); err != nil {
+		return models.AuthIdentity{}, err
+	}
+	if err := rfc2865.UserPassword_SetString(packet, password); err != nil {
+		return models.AuthIdentity{}, err
+	}
+	if err := rfc2865.NASIdentifier_SetString(packet, "nethsecurity-api"); err != nil {
+		return models.AuthIdentity{}, err
+	}
+	signature, err := messageAuthenticator(packet, packet.Authenticator)
+	if err != nil {
+		return models.AuthIdentity{}, err
+	}
+	if err := rfc2869.MessageAuthenticator_Set(packet, signature); err != nil {
+		return models.AuthIdentity{}, err
+	}
+
+	// send request, retried until the context is done
+	response, err := radius.Exchange(ctx, packet, configuration.Config.RADIUSServer)
+	if err != nil {
+		return models.AuthIdentity{}, err
+	}
+
+	// check Message-Authenticator of the response
+	received, err := rfc2869.MessageAuthenticator_Lookup(response)
+	if err != nil {
+		return models.AuthIdentity{}, errors.New("response without Message-Authenticator")
+	}
+	expected, err := messageAuthenticator(response, packet.Authenticator)
+	if err != nil {
+		return models.AuthIdentity{}, err
+	}
+	if !hmac.Equal(received, expected) {
+		return models.AuthIdentity{}, errors.New("response with invalid Message-Authenticator")
+	}
+	switch response.Code {
+	case radius.CodeAccessAccept:
+	case radius.CodeAccessReject:
+		return models.AuthIdentity{}, ErrInvalidCredentials
+	default:
+		// challenges of multi-step authentications are not supported
+		return models.AuthIdentity{}, fmt.Errorf("unexpected response %s", response.Code)
+	}
+
+	// read groups
+	groups := []string{}
+	classes, _ := rfc2865.Class_Gets(response)
+	for _, class := range classes {
+		groups = append(groups, string(class))
+	}
+	filters, _ := rfc2865.FilterID_GetStrings(response)
+	groups = append(groups, filters...)
+
+	return models.AuthIdentity{Username: username, Groups: groups}, nil
+}
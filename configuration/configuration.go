@@ -10,6 +10,7 @@
 package configuration
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -18,14 +19,97 @@ import (
 )
 
 type Configuration struct {
-	ListenAddress string `json:"listen_address"`
+	LogLevel              string `json:"log_level"`
+	LogFormat             string `json:"log_format"`
+	LogSyslog             string `json:"log_syslog"`
+	LogSyslogFacility     string `json:"log_syslog_facility"`
+	LogSyslogAuthFacility string `json:"log_syslog_auth_facility"`
+
+	ListenAddress     string `json:"listen_address"`
+	ListenSocketOwner string `json:"listen_socket_owner"`
+	ListenSocketGroup string `json:"listen_socket_group"`
+	ListenSocketMode  string `json:"listen_socket_mode"`
+	ShutdownTimeout   int64  `json:"shutdown_timeout"`
+
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	TLSCertFile      string `json:"tls_cert_file"`
+	TLSKeyFile       string `json:"tls_key_file"`
+	TLSMinVersion    string `json:"tls_min_version"`
+	TLSClientCAFile  string `json:"tls_client_ca_file"`
+	TLSClientCRLFile string `json:"tls_client_crl_file"`
+	ClientCertsFile  string `json:"client_certs_file"`
 
 	SecretJWT  string `json:"secret_jwt"`
 	Issuer2FA  string `json:"issuer_2fa"`
 	SecretsDir string `json:"secrets_dir"`
 	TokensDir  string `json:"tokens_dir"`
+	TokensDB   string `json:"tokens_db"`
+
+	JWTSigningAlg  string `json:"jwt_signing_alg"`
+	JWTKeysDir     string `json:"jwt_keys_dir"`
+	JWTKeyRotation int64  `json:"jwt_key_rotation"`
+
+	APIKeysFile string `json:"api_keys_file"`
+
+	TwoFactorTimeout int64 `json:"two_factor_timeout"`
+
+	PasswordMinLength  int   `json:"password_min_length"`
+	PasswordMinClasses int   `json:"password_min_classes"`
+	PasswordMaxAge     int64 `json:"password_max_age"`
+
+	WebAuthnRPID      string   `json:"webauthn_rp_id"`
+	WebAuthnRPOrigins []string `json:"webauthn_rp_origins"`
+
+	AuthBackends []string `json:"auth_backends"`
+	AuthTimeout  int64    `json:"auth_timeout"`
+
+	LDAPURL            string `json:"ldap_url"`
+	LDAPStartTLS       bool   `json:"ldap_start_tls"`
+	LDAPBindDN         string `json:"ldap_bind_dn"`
+	LDAPBindPassword   string `json:"ldap_bind_password"`
+	LDAPBaseDN         string `json:"ldap_base_dn"`
+	LDAPUserFilter     string `json:"ldap_user_filter"`
+	LDAPGroupAttribute string `json:"ldap_group_attribute"`
+
+	RADIUSServer string `json:"radius_server"`
+	RADIUSSecret string `json:"radius_secret"`
+
+	OIDCIssuer        string   `json:"oidc_issuer"`
+	OIDCClientID      string   `json:"oidc_client_id"`
+	OIDCClientSecret  string   `json:"oidc_client_secret"`
+	OIDCRedirectURL   string   `json:"oidc_redirect_url"`
+	OIDCScopes        []string `json:"oidc_scopes"`
+	OIDCUsernameClaim string   `json:"oidc_username_claim"`
+	OIDCGroupsClaim   string   `json:"oidc_groups_claim"`
+	OIDCPostLoginURL  string   `json:"oidc_post_login_url"`
+
+	SensitiveList      []string `json:"sensitive_list"`
+	RedactionRulesFile string   `json:"redaction_rules_file"`
 
-	SensitiveList []string `json:"sensitive_list"`
+	RolesFile      string `json:"roles_file"`
+	UBusPolicyFile string `json:"ubus_policy_file"`
+	SudoRulesFile  string `json:"sudo_rules_file"`
+	SudoMaxAge     int64  `json:"sudo_max_age"`
+
+	UBusSocket  string `json:"ubus_socket"`
+	UBusTimeout int64  `json:"ubus_timeout"`
+
+	UBusBatchMaxCalls    int `json:"ubus_batch_max_calls"`
+	UBusBatchParallelism int `json:"ubus_batch_parallelism"`
+
+	JobsRetention      int64 `json:"jobs_retention"`
+	JobsMaxRunning     int   `json:"jobs_max_running"`
+	JobsMaxRunningUser int   `json:"jobs_max_running_user"`
+
+	LockoutMaxFailures   int   `json:"lockout_max_failures"`
+	LockoutMaxFailuresIP int   `json:"lockout_max_failures_ip"`
+	LockoutBase          int64 `json:"lockout_base"`
+	LockoutMax           int64 `json:"lockout_max"`
+
+	AuditFile     string `json:"audit_file"`
+	AuditMaxSize  int64  `json:"audit_max_size"`
+	AuditMaxFiles int    `json:"audit_max_files"`
 
 	UploadFileMaxSize int64  `json:"upload_file_max_size"`
 	UploadFilePath    string `json:"upload_file_path"`
@@ -36,12 +120,98 @@ var Config = Configuration{}
 
 func Init() {
 	// read configuration from ENV
+	if os.Getenv("LOG_LEVEL") != "" {
+		Config.LogLevel = os.Getenv("LOG_LEVEL")
+	} else {
+		Config.LogLevel = "info"
+	}
+
+	if os.Getenv("LOG_FORMAT") != "" {
+		Config.LogFormat = os.Getenv("LOG_FORMAT")
+	} else {
+		Config.LogFormat = "text"
+	}
+
+	if os.Getenv("LOG_SYSLOG") != "" {
+		Config.LogSyslog = os.Getenv("LOG_SYSLOG")
+	}
+
+	if os.Getenv("LOG_SYSLOG_FACILITY") != "" {
+		Config.LogSyslogFacility = os.Getenv("LOG_SYSLOG_FACILITY")
+	} else {
+		Config.LogSyslogFacility = "daemon"
+	}
+
+	if os.Getenv("LOG_SYSLOG_AUTH_FACILITY") != "" {
+		Config.LogSyslogAuthFacility = os.Getenv("LOG_SYSLOG_AUTH_FACILITY")
+	} else {
+		Config.LogSyslogAuthFacility = "auth"
+	}
+
 	if os.Getenv("LISTEN_ADDRESS") != "" {
 		Config.ListenAddress = os.Getenv("LISTEN_ADDRESS")
 	} else {
 		Config.ListenAddress = "127.0.0.1:8080"
 	}
 
+	if os.Getenv("LISTEN_SOCKET_OWNER") != "" {
+		Config.ListenSocketOwner = os.Getenv("LISTEN_SOCKET_OWNER")
+	}
+
+	if os.Getenv("LISTEN_SOCKET_GROUP") != "" {
+		Config.ListenSocketGroup = os.Getenv("LISTEN_SOCKET_GROUP")
+	}
+
+	if os.Getenv("LISTEN_SOCKET_MODE") != "" {
+		Config.ListenSocketMode = os.Getenv("LISTEN_SOCKET_MODE")
+	} else {
+		Config.ListenSocketMode = "0660"
+	}
+
+	if os.Getenv("SHUTDOWN_TIMEOUT") != "" {
+		Config.ShutdownTimeout, _ = strconv.ParseInt(os.Getenv("SHUTDOWN_TIMEOUT"), 10, 64)
+	} else {
+		Config.ShutdownTimeout = 30
+	}
+
+	if os.Getenv("TLS_CERT_FILE") != "" {
+		Config.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	}
+
+	if os.Getenv("TLS_KEY_FILE") != "" {
+		Config.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	}
+
+	if os.Getenv("TLS_MIN_VERSION") != "" {
+		Config.TLSMinVersion = os.Getenv("TLS_MIN_VERSION")
+	} else {
+		Config.TLSMinVersion = "1.2"
+	}
+
+	if os.Getenv("TLS_CLIENT_CA_FILE") != "" {
+		Config.TLSClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	}
+
+	if os.Getenv("TLS_CLIENT_CRL_FILE") != "" {
+		Config.TLSClientCRLFile = os.Getenv("TLS_CLIENT_CRL_FILE")
+	}
+
+	// the client IP is read from X-Forwarded-For only when sent by a trusted proxy, by default the local
+	// one, or none when the server listens with HTTPS
+	if os.Getenv("TRUSTED_PROXIES") == "none" {
+		Config.TrustedProxies = nil
+	} else if os.Getenv("TRUSTED_PROXIES") != "" {
+		Config.TrustedProxies = strings.Split(os.Getenv("TRUSTED_PROXIES"), ",")
+	} else if Config.TLSCertFile == "" {
+		Config.TrustedProxies = []string{"127.0.0.1", "::1"}
+	}
+
+	if os.Getenv("CLIENT_CERTS_FILE") != "" {
+		Config.ClientCertsFile = os.Getenv("CLIENT_CERTS_FILE")
+	} else {
+		Config.ClientCertsFile = "/etc/ns-api-server/client_certs.json"
+	}
+
 	if os.Getenv("SECRET_JWT") != "" {
 		Config.SecretJWT = os.Getenv("SECRET_JWT")
 	} else {
@@ -62,6 +232,152 @@ func Init() {
 		os.Exit(1)
 	}
 
+	if os.Getenv("JWT_SIGNING_ALG") != "" {
+		Config.JWTSigningAlg = os.Getenv("JWT_SIGNING_ALG")
+	} else {
+		Config.JWTSigningAlg = "HS256"
+	}
+
+	if os.Getenv("JWT_KEYS_DIR") != "" {
+		Config.JWTKeysDir = os.Getenv("JWT_KEYS_DIR")
+	} else {
+		Config.JWTKeysDir = Config.SecretsDir + "/jwt_keys"
+	}
+
+	if os.Getenv("JWT_KEY_ROTATION") != "" {
+		Config.JWTKeyRotation, _ = strconv.ParseInt(os.Getenv("JWT_KEY_ROTATION"), 10, 64)
+	} else {
+		Config.JWTKeyRotation = 2592000
+	}
+
+	if os.Getenv("API_KEYS_FILE") != "" {
+		Config.APIKeysFile = os.Getenv("API_KEYS_FILE")
+	} else {
+		Config.APIKeysFile = Config.SecretsDir + "/api_keys.json"
+	}
+
+	if os.Getenv("TWO_FACTOR_TIMEOUT") != "" {
+		Config.TwoFactorTimeout, _ = strconv.ParseInt(os.Getenv("TWO_FACTOR_TIMEOUT"), 10, 64)
+	} else {
+		Config.TwoFactorTimeout = 300
+	}
+
+	if os.Getenv("PASSWORD_MIN_LENGTH") != "" {
+		Config.PasswordMinLength, _ = strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH"))
+	} else {
+		Config.PasswordMinLength = 8
+	}
+
+	if os.Getenv("PASSWORD_MIN_CLASSES") != "" {
+		Config.PasswordMinClasses, _ = strconv.Atoi(os.Getenv("PASSWORD_MIN_CLASSES"))
+	} else {
+		Config.PasswordMinClasses = 3
+	}
+
+	if os.Getenv("PASSWORD_MAX_AGE") != "" {
+		Config.PasswordMaxAge, _ = strconv.ParseInt(os.Getenv("PASSWORD_MAX_AGE"), 10, 64)
+	} else {
+		Config.PasswordMaxAge = 0
+	}
+
+	if os.Getenv("WEBAUTHN_RP_ID") != "" {
+		Config.WebAuthnRPID = os.Getenv("WEBAUTHN_RP_ID")
+	}
+
+	if os.Getenv("WEBAUTHN_RP_ORIGINS") != "" {
+		Config.WebAuthnRPOrigins = strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+	}
+
+	if os.Getenv("AUTH_BACKENDS") != "" {
+		Config.AuthBackends = strings.Split(os.Getenv("AUTH_BACKENDS"), ",")
+	} else {
+		Config.AuthBackends = []string{"local"}
+	}
+
+	if os.Getenv("AUTH_TIMEOUT") != "" {
+		Config.AuthTimeout, _ = strconv.ParseInt(os.Getenv("AUTH_TIMEOUT"), 10, 64)
+	} else {
+		Config.AuthTimeout = 5
+	}
+
+	if os.Getenv("LDAP_URL") != "" {
+		Config.LDAPURL = os.Getenv("LDAP_URL")
+	}
+
+	if os.Getenv("LDAP_START_TLS") != "" {
+		Config.LDAPStartTLS, _ = strconv.ParseBool(os.Getenv("LDAP_START_TLS"))
+	}
+
+	if os.Getenv("LDAP_BIND_DN") != "" {
+		Config.LDAPBindDN = os.Getenv("LDAP_BIND_DN")
+	}
+
+	if os.Getenv("LDAP_BIND_PASSWORD") != "" {
+		Config.LDAPBindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+	}
+
+	if os.Getenv("LDAP_BASE_DN") != "" {
+		Config.LDAPBaseDN = os.Getenv("LDAP_BASE_DN")
+	}
+
+	if os.Getenv("LDAP_USER_FILTER") != "" {
+		Config.LDAPUserFilter = os.Getenv("LDAP_USER_FILTER")
+	} else {
+		Config.LDAPUserFilter = "(uid=%s)"
+	}
+
+	if os.Getenv("LDAP_GROUP_ATTRIBUTE") != "" {
+		Config.LDAPGroupAttribute = os.Getenv("LDAP_GROUP_ATTRIBUTE")
+	} else {
+		Config.LDAPGroupAttribute = "memberOf"
+	}
+
+	if os.Getenv("RADIUS_SERVER") != "" {
+		Config.RADIUSServer = os.Getenv("RADIUS_SERVER")
+	}
+
+	if os.Getenv("RADIUS_SECRET") != "" {
+		Config.RADIUSSecret = os.Getenv("RADIUS_SECRET")
+	}
+
+	if os.Getenv("OIDC_ISSUER") != "" {
+		Config.OIDCIssuer = os.Getenv("OIDC_ISSUER")
+	}
+
+	if os.Getenv("OIDC_CLIENT_ID") != "" {
+		Config.OIDCClientID = os.Getenv("OIDC_CLIENT_ID")
+	}
+
+	if os.Getenv("OIDC_CLIENT_SECRET") != "" {
+		Config.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	}
+
+	if os.Getenv("OIDC_REDIRECT_URL") != "" {
+		Config.OIDCRedirectURL = os.Getenv("OIDC_REDIRECT_URL")
+	}
+
+	if os.Getenv("OIDC_SCOPES") != "" {
+		Config.OIDCScopes = strings.Split(os.Getenv("OIDC_SCOPES"), ",")
+	} else {
+		Config.OIDCScopes = []string{"openid", "profile", "email"}
+	}
+
+	if os.Getenv("OIDC_USERNAME_CLAIM") != "" {
+		Config.OIDCUsernameClaim = os.Getenv("OIDC_USERNAME_CLAIM")
+	} else {
+		Config.OIDCUsernameClaim = "sub"
+	}
+
+	if os.Getenv("OIDC_GROUPS_CLAIM") != "" {
+		Config.OIDCGroupsClaim = os.Getenv("OIDC_GROUPS_CLAIM")
+	} else {
+		Config.OIDCGroupsClaim = "groups"
+	}
+
+	if os.Getenv("OIDC_POST_LOGIN_URL") != "" {
+		Config.OIDCPostLoginURL = os.Getenv("OIDC_POST_LOGIN_URL")
+	}
+
 	if os.Getenv("TOKENS_DIR") != "" {
 		Config.TokensDir = os.Getenv("TOKENS_DIR")
 	} else {
@@ -69,10 +385,118 @@ func Init() {
 		os.Exit(1)
 	}
 
+	if os.Getenv("TOKENS_DB") != "" {
+		Config.TokensDB = os.Getenv("TOKENS_DB")
+	} else {
+		Config.TokensDB = Config.TokensDir + "/tokens.db"
+	}
+
 	if os.Getenv("SENSITIVE_LIST") != "" {
 		Config.SensitiveList = strings.Split(os.Getenv("SENSITIVE_LIST"), ",")
 	} else {
-		Config.SensitiveList = []string{"password", "secret", "token"}
+		Config.SensitiveList = []string{"*password*", "*secret*", "*token*"}
+	}
+
+	if os.Getenv("REDACTION_RULES_FILE") != "" {
+		Config.RedactionRulesFile = os.Getenv("REDACTION_RULES_FILE")
+	} else {
+		Config.RedactionRulesFile = "/etc/ns-api-server/redaction_rules.json"
+	}
+
+	if os.Getenv("ROLES_FILE") != "" {
+		Config.RolesFile = os.Getenv("ROLES_FILE")
+	} else {
+		Config.RolesFile = "/etc/ns-api-server/roles.json"
+	}
+
+	if os.Getenv("UBUS_POLICY_FILE") != "" {
+		Config.UBusPolicyFile = os.Getenv("UBUS_POLICY_FILE")
+	} else {
+		Config.UBusPolicyFile = "/etc/ns-api-server/ubus_policy.json"
+	}
+
+	if os.Getenv("SUDO_RULES_FILE") != "" {
+		Config.SudoRulesFile = os.Getenv("SUDO_RULES_FILE")
+	} else {
+		Config.SudoRulesFile = "/etc/ns-api-server/sudo_rules.json"
+	}
+
+	if os.Getenv("SUDO_MAX_AGE") != "" {
+		Config.SudoMaxAge, _ = strconv.ParseInt(os.Getenv("SUDO_MAX_AGE"), 10, 64)
+	} else {
+		Config.SudoMaxAge = 300
+	}
+
+	// load roles, ubus policy, sudo rules and redaction rules
+	if err := Reload(); err != nil {
+		logs.Logs.Println("[CRITICAL][ENV] " + err.Error())
+		os.Exit(1)
+	}
+
+	if os.Getenv("UBUS_SOCKET") != "" {
+		Config.UBusSocket = os.Getenv("UBUS_SOCKET")
+	} else {
+		Config.UBusSocket = "/var/run/ubus/ubus.sock"
+	}
+
+	if os.Getenv("UBUS_TIMEOUT") != "" {
+		Config.UBusTimeout, _ = strconv.ParseInt(os.Getenv("UBUS_TIMEOUT"), 10, 64)
+	} else {
+		Config.UBusTimeout = 300
+	}
+
+	if os.Getenv("UBUS_BATCH_MAX_CALLS") != "" {
+		Config.UBusBatchMaxCalls, _ = strconv.Atoi(os.Getenv("UBUS_BATCH_MAX_CALLS"))
+	} else {
+		Config.UBusBatchMaxCalls = 50
+	}
+
+	if os.Getenv("UBUS_BATCH_PARALLELISM") != "" {
+		Config.UBusBatchParallelism, _ = strconv.Atoi(os.Getenv("UBUS_BATCH_PARALLELISM"))
+	} else {
+		Config.UBusBatchParallelism = 4
+	}
+
+	if os.Getenv("JOBS_RETENTION") != "" {
+		Config.JobsRetention, _ = strconv.ParseInt(os.Getenv("JOBS_RETENTION"), 10, 64)
+	} else {
+		Config.JobsRetention = 3600
+	}
+
+	if os.Getenv("JOBS_MAX_RUNNING") != "" {
+		Config.JobsMaxRunning, _ = strconv.Atoi(os.Getenv("JOBS_MAX_RUNNING"))
+	} else {
+		Config.JobsMaxRunning = 16
+	}
+
+	if os.Getenv("JOBS_MAX_RUNNING_USER") != "" {
+		Config.JobsMaxRunningUser, _ = strconv.Atoi(os.Getenv("JOBS_MAX_RUNNING_USER"))
+	} else {
+		Config.JobsMaxRunningUser = 4
+	}
+
+	if os.Getenv("LOCKOUT_MAX_FAILURES") != "" {
+		Config.LockoutMaxFailures, _ = strconv.Atoi(os.Getenv("LOCKOUT_MAX_FAILURES"))
+	} else {
+		Config.LockoutMaxFailures = 5
+	}
+
+	if os.Getenv("LOCKOUT_MAX_FAILURES_IP") != "" {
+		Config.LockoutMaxFailuresIP, _ = strconv.Atoi(os.Getenv("LOCKOUT_MAX_FAILURES_IP"))
+	} else {
+		Config.LockoutMaxFailuresIP = 20
+	}
+
+	if os.Getenv("LOCKOUT_BASE") != "" {
+		Config.LockoutBase, _ = strconv.ParseInt(os.Getenv("LOCKOUT_BASE"), 10, 64)
+	} else {
+		Config.LockoutBase = 30
+	}
+
+	if os.Getenv("LOCKOUT_MAX") != "" {
+		Config.LockoutMax, _ = strconv.ParseInt(os.Getenv("LOCKOUT_MAX"), 10, 64)
+	} else {
+		Config.LockoutMax = 900
 	}
 
 	if os.Getenv("DOWNLOAD_FILE_PATH") != "" {
@@ -91,4 +515,39 @@ func Init() {
 	} else {
 		Config.UploadFileMaxSize = 32
 	}
+
+	if os.Getenv("AUDIT_FILE") != "" {
+		Config.AuditFile = os.Getenv("AUDIT_FILE")
+	} else {
+		Config.AuditFile = "/var/log/ns-api-server/audit.log"
+	}
+
+	if os.Getenv("AUDIT_MAX_SIZE") != "" {
+		Config.AuditMaxSize, _ = strconv.ParseInt(os.Getenv("AUDIT_MAX_SIZE"), 10, 64)
+	} else {
+		Config.AuditMaxSize = 10
+	}
+
+	if os.Getenv("AUDIT_MAX_FILES") != "" {
+		Config.AuditMaxFiles, _ = strconv.Atoi(os.Getenv("AUDIT_MAX_FILES"))
+	} else {
+		Config.AuditMaxFiles = 5
+	}
+}
+
+// Reload reads again the configuration files, it is called on startup and on SIGHUP
+func Reload() error {
+	if err := LoadRoles(); err != nil {
+		return fmt.Errorf("failed to load roles file %s: %w", Config.RolesFile, err)
+	}
+	if err := LoadUBusPolicy(); err != nil {
+		return fmt.Errorf("failed to load ubus policy file %s: %w", Config.UBusPolicyFile, err)
+	}
+	if err := LoadSudoRules(); err != nil {
+		return fmt.Errorf("failed to load sudo rules file %s: %w", Config.SudoRulesFile, err)
+	}
+	if err := LoadRedactionRules(); err != nil {
+		return fmt.Errorf("failed to load redaction rules file %s: %w", Config.RedactionRulesFile, err)
+	}
+	return nil
 }
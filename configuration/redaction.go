@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package configuration
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/utils"
+)
+
+type redactionRule struct {
+	path   *regexp.Regexp
+	method *regexp.Regexp
+	keys   []*regexp.Regexp
+}
+
+var sensitiveKeys []*regexp.Regexp
+var redactionRules []redactionRule
+var redactionLock sync.RWMutex
+
+// keyRegexp compiles a key pattern: a regular expression between slashes, e.g. /^(api_)?token$/,
+// or a case insensitive glob pattern, e.g. *password*
+func keyRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimSpace(pattern)
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+	return regexp.Compile("(?i)" + utils.GlobRegexp(pattern))
+}
+
+// keyRegexps compiles a list of key patterns
+func keyRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		key, err := keyRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, key)
+	}
+	return compiled, nil
+}
+
+// LoadRedactionRules compiles the keys of SENSITIVE_LIST, masked in every logged body, and reads the
+// keys masked only in the payload of some ubus calls from Config.RedactionRulesFile
+func LoadRedactionRules() error {
+	keys, err := keyRegexps(Config.SensitiveList)
+	if err != nil {
+		return err
+	}
+
+	// read rules file, if missing only SENSITIVE_LIST is used
+	rules := []models.RedactionRule{}
+	rulesB, err := os.ReadFile(Config.RedactionRulesFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := json.Unmarshal(rulesB, &rules); err != nil {
+		return err
+	}
+
+	// compile regexes, path and method must match the whole value
+	var compiled []redactionRule
+	for _, rule := range rules {
+		pathRegex, err := regexp.Compile("^(?:" + rule.Path + ")$")
+		if err != nil {
+			return err
+		}
+		if rule.Method == "" {
+			rule.Method = ".*"
+		}
+		methodRegex, err := regexp.Compile("^(?:" + rule.Method + ")$")
+		if err != nil {
+			return err
+		}
+		ruleKeys, err := keyRegexps(rule.Keys)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, redactionRule{path: pathRegex, method: methodRegex, keys: ruleKeys})
+	}
+
+	// replace current rules
+	redactionLock.Lock()
+	sensitiveKeys = keys
+	redactionRules = compiled
+	redactionLock.Unlock()
+
+	return nil
+}
+
+// SensitiveKeys returns the patterns of the keys to mask, the ones of SENSITIVE_LIST plus the ones of
+// the rules matching the ubus call, if path is not empty
+func SensitiveKeys(path string, method string) []*regexp.Regexp {
+	redactionLock.RLock()
+	defer redactionLock.RUnlock()
+
+	keys := sensitiveKeys
+	if path == "" {
+		return keys
+	}
+	for _, rule := range redactionRules {
+		if rule.path.MatchString(path) && rule.method.MatchString(method) {
+			keys = append(keys[:len(keys):len(keys)], rule.keys...)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package configuration
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// AdminRole is the built-in role granted every action, given to local users when no roles file exists
+const AdminRole = "admin"
+
+var rolesConfig models.RolesConfig
+var rolesLock sync.RWMutex
+
+// LoadRoles reads the role definitions and user assignments from Config.RolesFile
+func LoadRoles() error {
+	var roles models.RolesConfig
+
+	// read roles file, if missing every local user is admin like before roles were introduced
+	rolesB, err := os.ReadFile(Config.RolesFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		logs.Logs.Println("[WARNING][RBAC] roles file " + Config.RolesFile + " not found, every local user gets the " + AdminRole + " role")
+		roles.DefaultRole = AdminRole
+	} else if err := json.Unmarshal(rolesB, &roles); err != nil {
+		return err
+	}
+
+	// add built-in admin role, if not overridden
+	if roles.Roles == nil {
+		roles.Roles = map[string]models.Role{}
+	}
+	if _, ok := roles.Roles[AdminRole]; !ok {
+		roles.Roles[AdminRole] = models.Role{
+			UBus:   []models.UBusRule{{Path: "*", Method: "*"}},
+			Routes: []models.RouteRule{{Method: "*", Path: "*"}},
+		}
+	}
+
+	// replace current roles
+	rolesLock.Lock()
+	rolesConfig = roles
+	rolesLock.Unlock()
+
+	return nil
+}
+
+// GetUserRole returns the role assigned to the user, or the default one
+func GetUserRole(username string) string {
+	rolesLock.RLock()
+	defer rolesLock.RUnlock()
+
+	if role, ok := rolesConfig.Users[username]; ok {
+		return role
+	}
+	return rolesConfig.DefaultRole
+}
+
+// GetGroupsRole returns the role of the first mapping matching one of the groups of an external
+// identity, or an empty string when no group is mapped
+func GetGroupsRole(groups []string) string {
+	rolesLock.RLock()
+	defer rolesLock.RUnlock()
+
+	for _, mapping := range rolesConfig.Groups {
+		for _, group := range groups {
+			if mapping.Group == group {
+				return mapping.Role
+			}
+		}
+	}
+	return ""
+}
+
+// GetRoleActions returns the list of actions granted to the role, in the form
+// ubus:<path>:<method> and route:<path>:<http method>
+func GetRoleActions(role string) []string {
+	rolesLock.RLock()
+	defer rolesLock.RUnlock()
+
+	actions := []string{}
+	definition, ok := rolesConfig.Roles[role]
+	if !ok {
+		if role != "" {
+			logs.Logs.Println("[WARNING][RBAC] role " + role + " is not defined")
+		}
+		return actions
+	}
+
+	for _, rule := range definition.UBus {
+		actions = append(actions, "ubus:"+rule.Path+":"+rule.Method)
+	}
+	for _, rule := range definition.Routes {
+		actions = append(actions, "route:"+rule.Path+":"+rule.Method)
+	}
+
+	return actions
+}
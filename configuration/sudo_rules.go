@@ -0,0 +1,84 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package configuration
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// defaultSudoRules is used when the sudo rules file does not exist
+var defaultSudoRules = []models.SudoRule{
+	{Path: "ns.ssh", Method: "add-key|delete-key"},
+}
+
+type sudoRule struct {
+	models.SudoRule
+	path   *regexp.Regexp
+	method *regexp.Regexp
+}
+
+var sudoRules []sudoRule
+var sudoRulesLock sync.RWMutex
+
+// LoadSudoRules reads the ubus calls that require sudo mode from Config.SudoRulesFile
+func LoadSudoRules() error {
+	rules := defaultSudoRules
+
+	// read rules file, if missing use default ones
+	rulesB, err := os.ReadFile(Config.SudoRulesFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		rules = nil
+		if err := json.Unmarshal(rulesB, &rules); err != nil {
+			return err
+		}
+	}
+
+	// compile regexes, they must match the whole path and method
+	var compiled []sudoRule
+	for _, rule := range rules {
+		pathRegex, err := regexp.Compile("^(?:" + rule.Path + ")$")
+		if err != nil {
+			return err
+		}
+		methodRegex, err := regexp.Compile("^(?:" + rule.Method + ")$")
+		if err != nil {
+			return err
+		}
+		if rule.MaxAge <= 0 {
+			rule.MaxAge = Config.SudoMaxAge
+		}
+		compiled = append(compiled, sudoRule{SudoRule: rule, path: pathRegex, method: methodRegex})
+	}
+
+	// replace current rules
+	sudoRulesLock.Lock()
+	sudoRules = compiled
+	sudoRulesLock.Unlock()
+
+	return nil
+}
+
+// GetSudoRule returns the first sudo rule matching the ubus call, if any
+func GetSudoRule(path string, method string) (models.SudoRule, bool) {
+	sudoRulesLock.RLock()
+	defer sudoRulesLock.RUnlock()
+
+	for _, rule := range sudoRules {
+		if rule.path.MatchString(path) && rule.method.MatchString(method) {
+			return rule.SudoRule, true
+		}
+	}
+	return models.SudoRule{}, false
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package configuration
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/utils"
+)
+
+// defaultUBusPolicy is used when the policy file does not exist
+var defaultUBusPolicy = models.UBusPolicy{
+	Allow: []models.UBusRule{
+		{Path: "ns.*", Method: "*"},
+		{Path: "uci", Method: "get"},
+		{Path: "uci", Method: "set"},
+		{Path: "uci", Method: "changes"},
+		{Path: "uci", Method: "revert"},
+		{Path: "luci", Method: "getTimezones"},
+		{Path: "luci", Method: "setInitAction"},
+		{Path: "system", Method: "info"},
+		{Path: "system", Method: "board"},
+		{Path: "network.interface", Method: "dump"},
+	},
+}
+
+var ubusPolicy models.UBusPolicy
+var ubusPolicyLock sync.RWMutex
+
+// LoadUBusPolicy reads the allowed and denied ubus calls from Config.UBusPolicyFile
+func LoadUBusPolicy() error {
+	policy := defaultUBusPolicy
+
+	// read policy file, if missing use default one
+	policyB, err := os.ReadFile(Config.UBusPolicyFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		policy = models.UBusPolicy{}
+		if err := json.Unmarshal(policyB, &policy); err != nil {
+			return err
+		}
+	}
+
+	// replace current policy
+	ubusPolicyLock.Lock()
+	ubusPolicy = policy
+	ubusPolicyLock.Unlock()
+
+	return nil
+}
+
+// UBusAllowed checks if the ubus call is allowed by the policy, deny rules win over allow rules
+func UBusAllowed(path string, method string) bool {
+	// paths are also used to compose ns.* script paths, never allow directories
+	if path == "" || strings.Contains(path, "/") {
+		return false
+	}
+
+	ubusPolicyLock.RLock()
+	defer ubusPolicyLock.RUnlock()
+
+	for _, rule := range ubusPolicy.Deny {
+		if utils.MatchPattern(rule.Path, path) && utils.MatchPattern(rule.Method, method) {
+			return false
+		}
+	}
+	for _, rule := range ubusPolicy.Allow {
+		if utils.MatchPattern(rule.Path, path) && utils.MatchPattern(rule.Method, method) {
+			return true
+		}
+	}
+	return false
+}
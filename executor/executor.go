@@ -0,0 +1,172 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+// Executor runs ubus calls and rpcd scripts on behalf of the API handlers
+type Executor interface {
+	// Call invokes the method of a ubus object, returning the JSON reply.
+	// Calls ending with a ubus status other than success return an *ubus.StatusError
+	Call(ctx context.Context, path string, method string, payload interface{}) ([]byte, error)
+
+	// Run executes a command writing stdin to it, returning its combined output.
+	// Commands ending with a non-zero exit code return an *ExitError
+	Run(ctx context.Context, name string, args []string, stdin []byte) ([]byte, error)
+
+	// Stream executes a command like Run, passing every stdout and stderr line to onLine as soon
+	// as it is printed. It returns the stdout of the command only
+	Stream(ctx context.Context, name string, args []string, stdin []byte, onLine func(stream string, line string)) ([]byte, error)
+}
+
+// names of the streams passed to the onLine callback of Stream
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// ExitError is returned when a command exits with a non-zero code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return "exit status " + strconv.Itoa(e.Code)
+}
+
+// Default is the executor used by the API handlers, it can be replaced with a Fake
+var Default Executor = System{}
+
+// ubusCommand is the ubus client used when the ubusd socket is not available
+var ubusCommand = "/bin/ubus"
+
+// System runs calls through the ubusd socket and commands as child processes
+type System struct{}
+
+// Call uses the native ubus client, falling back to the ubus command when the socket is not available
+func (System) Call(ctx context.Context, path string, method string, payload interface{}) ([]byte, error) {
+	timeout := time.Duration(configuration.Config.UBusTimeout) * time.Second
+
+	// use native client
+	conn, err := ubus.Dial(configuration.Config.UBusSocket, timeout)
+	if err == nil {
+		defer conn.Close()
+
+		// abort pending request when context is done
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		defer stop()
+
+		out, err := conn.Call(path, method, payload)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return out, err
+	}
+	logs.Logs.Println("[WARNING][UBUS] ubus socket not available, fallback to "+ubusCommand+":", err.Error())
+
+	// fallback to ubus command, its exit code is the ubus status
+	jsonPayload, _ := json.Marshal(payload)
+	out, err := System{}.Run(ctx, ubusCommand, []string{"-S", "-t", strconv.FormatInt(configuration.Config.UBusTimeout, 10), "call", path, method, string(jsonPayload[:])}, nil)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return out, &ubus.StatusError{Code: exitErr.Code}
+	}
+	return out, err
+}
+
+// Run executes the command, killing it when context is done
+func (System) Run(ctx context.Context, name string, args []string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return out, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return out, &ExitError{Code: exitErr.ExitCode()}
+		}
+		return out, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// Stream executes the command reading stdout and stderr line by line, killing it when context is done
+func (System) Stream(ctx context.Context, name string, args []string, stdin []byte, onLine func(stream string, line string)) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// read both streams until the command closes them
+	var stdout bytes.Buffer
+	var wg sync.WaitGroup
+	readLines := func(stream string, pipe io.Reader, out *bytes.Buffer) {
+		defer wg.Done()
+		reader := bufio.NewReader(pipe)
+		for {
+			line, errRead := reader.ReadString('\n')
+			if out != nil {
+				out.WriteString(line)
+			}
+			if line = strings.TrimRight(line, "\r\n"); line != "" || errRead == nil {
+				onLine(stream, line)
+			}
+			if errRead != nil {
+				return
+			}
+		}
+	}
+	wg.Add(2)
+	go readLines(Stdout, stdoutPipe, &stdout)
+	go readLines(Stderr, stderrPipe, nil)
+	wg.Wait()
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return stdout.Bytes(), ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stdout.Bytes(), &ExitError{Code: exitErr.ExitCode()}
+		}
+		return stdout.Bytes(), fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+func TestMain(m *testing.M) {
+	logs.Init("nethsecurity_api_test")
+	configuration.Config.UBusTimeout = 5
+	os.Exit(m.Run())
+}
+
+func TestCallFallback(t *testing.T) {
+	// the ubus command prints its arguments, the exit code is read from the method name
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$6" in
+	fail) echo "Command failed: Permission denied" >&2; exit 6 ;;
+esac
+echo "{\"args\": \"$*\"}"
+`
+	ubusCommand = filepath.Join(dir, "ubus")
+	defer func() { ubusCommand = "/bin/ubus" }()
+	if err := os.WriteFile(ubusCommand, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	configuration.Config.UBusSocket = filepath.Join(dir, "missing.sock")
+
+	tests := []struct {
+		name    string
+		method  string
+		payload interface{}
+		want    string
+		status  int
+	}{
+		{
+			name:    "payload",
+			method:  "status",
+			payload: map[string]interface{}{"interface": "wan"},
+			want:    `{"args": "-S -t 5 call network.interface status {"interface":"wan"}"}` + "\n",
+		},
+		{
+			name:   "no payload",
+			method: "dump",
+			want:   `{"args": "-S -t 5 call network.interface dump null"}` + "\n",
+		},
+		{
+			name:   "exit code is the ubus status",
+			method: "fail",
+			status: ubus.StatusPermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := System{}.Call(context.Background(), "network.interface", tt.method, tt.payload)
+			if tt.status != ubus.StatusOK {
+				var statusErr *ubus.StatusError
+				if !errors.As(err, &statusErr) || statusErr.Code != tt.status {
+					t.Fatalf("got %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Fatalf("got %q, want %q", out, tt.want)
+			}
+		})
+	}
+
+	// the ubus command is not available either
+	ubusCommand = filepath.Join(dir, "missing")
+	if _, err := (System{}).Call(context.Background(), "network.interface", "status", nil); err == nil {
+		t.Fatal("call without socket and command succeeded")
+	}
+}
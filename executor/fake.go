@@ -0,0 +1,129 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+// FakeResponse is a scripted reply of the fake executor
+type FakeResponse struct {
+	Output string
+	Err    error
+}
+
+// FakeRequest records a call or command received by the fake executor
+type FakeRequest struct {
+	Path    string
+	Method  string
+	Payload interface{}
+	Name    string
+	Args    []string
+	Stdin   string
+}
+
+// Fake replays scripted ubus and rpcd responses, to run the handlers without an OpenWrt system
+type Fake struct {
+	lock     sync.Mutex
+	calls    map[string]FakeResponse
+	commands map[string]FakeResponse
+	requests []FakeRequest
+}
+
+// NewFake returns an empty fake executor, every call not scripted returns ubus.StatusNotFound
+func NewFake() *Fake {
+	return &Fake{
+		calls:    map[string]FakeResponse{},
+		commands: map[string]FakeResponse{},
+	}
+}
+
+// OnCall scripts the reply of a ubus call
+func (f *Fake) OnCall(path string, method string, output string, err error) *Fake {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.calls[path+" "+method] = FakeResponse{Output: output, Err: err}
+	return f
+}
+
+// OnCommand scripts the output of a command, exitCode other than 0 returns an *ExitError
+func (f *Fake) OnCommand(name string, args []string, output string, exitCode int) *Fake {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var err error
+	if exitCode != 0 {
+		err = &ExitError{Code: exitCode}
+	}
+	f.commands[commandKey(name, args)] = FakeResponse{Output: output, Err: err}
+	return f
+}
+
+// OnScript scripts the output of a ns.* rpcd script method
+func (f *Fake) OnScript(path string, method string, output string, exitCode int) *Fake {
+	return f.OnCommand("/usr/libexec/rpcd/"+path, []string{"call", method}, output, exitCode)
+}
+
+// Requests returns the calls and commands received so far
+func (f *Fake) Requests() []FakeRequest {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]FakeRequest(nil), f.requests...)
+}
+
+func (f *Fake) Call(ctx context.Context, path string, method string, payload interface{}) ([]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.requests = append(f.requests, FakeRequest{Path: path, Method: method, Payload: payload})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	reply, ok := f.calls[path+" "+method]
+	if !ok {
+		return nil, &ubus.StatusError{Code: ubus.StatusNotFound}
+	}
+	return []byte(reply.Output), reply.Err
+}
+
+func (f *Fake) Run(ctx context.Context, name string, args []string, stdin []byte) ([]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.requests = append(f.requests, FakeRequest{Name: name, Args: args, Stdin: string(stdin)})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	reply, ok := f.commands[commandKey(name, args)]
+	if !ok {
+		return nil, errors.New(name + ": no such file or directory")
+	}
+	return []byte(reply.Output), reply.Err
+}
+
+func commandKey(name string, args []string) string {
+	return strings.Join(append([]string{name}, args...), " ")
+}
+
+// Stream replays the scripted output of the command one line at a time on stdout
+func (f *Fake) Stream(ctx context.Context, name string, args []string, stdin []byte, onLine func(stream string, line string)) ([]byte, error) {
+	out, err := f.Run(ctx, name, args, stdin)
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			onLine(Stdout, line)
+		}
+	}
+	return out, err
+}
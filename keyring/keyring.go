@@ -0,0 +1,295 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+)
+
+// supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+)
+
+// Key is a signing key saved inside the keys directory, the key material is the HMAC secret or
+// the PKCS8 private key
+type Key struct {
+	ID        string    `json:"kid"`
+	Alg       string    `json:"alg"`
+	CreatedAt time.Time `json:"created_at"`
+	Material  []byte    `json:"key"`
+
+	private interface{}
+	public  interface{}
+}
+
+var keys []*Key
+var keysLock sync.RWMutex
+
+// parse decodes the key material
+func (k *Key) parse() error {
+	switch k.Alg {
+	case AlgHS256:
+		k.private = k.Material
+		k.public = k.Material
+	case AlgEdDSA, AlgES256:
+		private, err := x509.ParsePKCS8PrivateKey(k.Material)
+		if err != nil {
+			return err
+		}
+		switch p := private.(type) {
+		case ed25519.PrivateKey:
+			if k.Alg != AlgEdDSA {
+				return fmt.Errorf("key %s is not %s", k.ID, k.Alg)
+			}
+			k.private = p
+			k.public = p.Public()
+		case *ecdsa.PrivateKey:
+			if k.Alg != AlgES256 || p.Curve != elliptic.P256() {
+				return fmt.Errorf("key %s is not %s", k.ID, k.Alg)
+			}
+			k.private = p
+			k.public = &p.PublicKey
+		default:
+			return fmt.Errorf("key %s has unsupported type", k.ID)
+		}
+	default:
+		return fmt.Errorf("key %s has unsupported algorithm %s", k.ID, k.Alg)
+	}
+	return nil
+}
+
+// generate creates a new key for the algorithm
+func generate(alg string) (*Key, error) {
+	key := &Key{ID: uuid.New().String(), Alg: alg, CreatedAt: time.Now()}
+
+	var err error
+	switch alg {
+	case AlgHS256:
+		key.Material = make([]byte, 32)
+		_, err = rand.Read(key.Material)
+	case AlgEdDSA:
+		var private ed25519.PrivateKey
+		if _, private, err = ed25519.GenerateKey(rand.Reader); err == nil {
+			key.Material, err = x509.MarshalPKCS8PrivateKey(private)
+		}
+	case AlgES256:
+		var private *ecdsa.PrivateKey
+		if private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err == nil {
+			key.Material, err = x509.MarshalPKCS8PrivateKey(private)
+		}
+	default:
+		err = fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, key.parse()
+}
+
+// save writes the key inside the keys directory
+func save(key *Key) error {
+	content, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configuration.Config.JWTKeysDir, 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(configuration.Config.JWTKeysDir, key.ID+".json")
+	if err := os.WriteFile(path+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Init loads the keys and creates the first one, or a new one when the signing algorithm changed
+func Init() error {
+	entries, err := os.ReadDir(configuration.Config.JWTKeysDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	loaded := []*Key{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(configuration.Config.JWTKeysDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		key := &Key{}
+		if err := json.Unmarshal(content, key); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		if err := key.parse(); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		loaded = append(loaded, key)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].CreatedAt.Before(loaded[j].CreatedAt) })
+
+	keysLock.Lock()
+	keys = loaded
+	keysLock.Unlock()
+
+	current := Current()
+	if current == nil || current.Alg != configuration.Config.JWTSigningAlg {
+		return add()
+	}
+	return nil
+}
+
+// add generates and saves a new signing key
+func add() error {
+	key, err := generate(configuration.Config.JWTSigningAlg)
+	if err != nil {
+		return err
+	}
+	if err := save(key); err != nil {
+		return err
+	}
+
+	keysLock.Lock()
+	keys = append(keys, key)
+	keysLock.Unlock()
+
+	logs.Logs.Println("[INFO][JWT] new " + key.Alg + " signing key " + key.ID)
+	return nil
+}
+
+// Current returns the key used to sign new tokens, the newest one
+func Current() *Key {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys[len(keys)-1]
+}
+
+// Rotate creates a new key when the current one is older than maxAge, and removes keys replaced
+// more than retention ago: tokens they signed are expired and can no longer be refreshed
+func Rotate(maxAge time.Duration, retention time.Duration) error {
+	current := Current()
+	if maxAge > 0 && current != nil && time.Since(current.CreatedAt) > maxAge {
+		if err := add(); err != nil {
+			return err
+		}
+	}
+
+	keysLock.Lock()
+	defer keysLock.Unlock()
+
+	kept := []*Key{}
+	for i, key := range keys {
+		// a key is replaced when the next one is created
+		if i < len(keys)-1 && time.Since(keys[i+1].CreatedAt) > retention {
+			if err := os.Remove(filepath.Join(configuration.Config.JWTKeysDir, key.ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			logs.Logs.Println("[INFO][JWT] removed signing key " + key.ID)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	keys = kept
+	return nil
+}
+
+// Sign signs the claims with the current key, setting its id in the kid header
+func Sign(claims jwt.MapClaims) (string, error) {
+	key := Current()
+	if key == nil {
+		return "", errors.New("no signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// KeyFunc returns the key to verify a token, by its kid header. Tokens without kid were issued before
+// key rotation and are verified with SECRET_JWT
+func KeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(configuration.Config.SecretJWT), nil
+	}
+
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+
+	for _, key := range keys {
+		if key.ID == kid {
+			// the algorithm is bound to the key
+			if token.Method.Alg() != key.Alg {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return key.public, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key: %s", kid)
+}
+
+// JWKS returns the public keys in JSON Web Key Set format, HMAC keys are secret and not included
+func JWKS() map[string]interface{} {
+	keysLock.RLock()
+	defer keysLock.RUnlock()
+
+	set := []map[string]interface{}{}
+	for _, key := range keys {
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			set = append(set, map[string]interface{}{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+				"kid": key.ID,
+				"alg": key.Alg,
+				"use": "sig",
+			})
+		case *ecdsa.PublicKey:
+			set = append(set, map[string]interface{}{
+				"kty": "EC",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+				"kid": key.ID,
+				"alg": key.Alg,
+				"use": "sig",
+			})
+		}
+	}
+	return map[string]interface{}{"keys": set}
+}
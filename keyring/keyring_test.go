@@ -0,0 +1,270 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package keyring
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+)
+
+func TestMain(m *testing.M) {
+	logs.Init("nethsecurity_api_test")
+	configuration.Config.SecretJWT = "legacy-secret"
+	os.Exit(m.Run())
+}
+
+// useKeysDir initializes the keyring inside an empty directory with the given algorithm
+func useKeysDir(t *testing.T, alg string) string {
+	dir := filepath.Join(t.TempDir(), "jwt_keys")
+	configuration.Config.JWTKeysDir = dir
+	configuration.Config.JWTSigningAlg = alg
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// keyFiles returns the ids of the keys saved in the directory
+func keyFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return ids
+}
+
+// verify parses the token with the keyring, as the JWT middleware does
+func verify(token string) error {
+	_, err := jwt.Parse(token, KeyFunc)
+	return err
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgEdDSA, AlgES256} {
+		t.Run(alg, func(t *testing.T) {
+			useKeysDir(t, alg)
+
+			token, err := Sign(jwt.MapClaims{"id": "root"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verify(token); err != nil {
+				t.Fatalf("token of current key rejected: %v", err)
+			}
+
+			// public keys are published, secrets are not
+			published := len(JWKS()["keys"].([]map[string]interface{}))
+			if (alg == AlgHS256) != (published == 0) {
+				t.Fatalf("%d keys published for %s", published, alg)
+			}
+		})
+	}
+}
+
+func TestKeyFuncRejects(t *testing.T) {
+	useKeysDir(t, AlgEdDSA)
+	current := Current()
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		valid bool
+	}{
+		{
+			// the public key of an asymmetric key is not a secret, it can not be an HMAC key
+			name: "HS256 with the kid of an EdDSA key",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": "root"})
+				token.Header["kid"] = current.ID
+				signed, err := token.SignedString([]byte(current.public.(ed25519.PublicKey)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "EdDSA without kid",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"id": "root"})
+				signed, err := token.SignedString(current.private)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"id": "root"})
+				token.Header["kid"] = "unknown"
+				signed, err := token.SignedString(current.private)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			name: "HS256 without kid signed with another secret",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": "root"}).SignedString([]byte("other"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+		},
+		{
+			// tokens issued before key rotation
+			name: "HS256 without kid signed with SECRET_JWT",
+			token: func(t *testing.T) string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": "root"}).SignedString([]byte(configuration.Config.SecretJWT))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			},
+			valid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verify(tt.token(t))
+			if tt.valid && err != nil {
+				t.Fatalf("token rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("token accepted")
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := useKeysDir(t, AlgES256)
+	previous := Current()
+	token, err := Sign(jwt.MapClaims{"id": "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a young key is not rotated
+	if err := Rotate(time.Hour, 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if Current() != previous {
+		t.Fatal("key rotated before max age")
+	}
+
+	// an old key is replaced, but kept during the retention window
+	previous.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := Rotate(time.Hour, 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	current := Current()
+	if current == previous || current.Alg != AlgES256 {
+		t.Fatalf("key not rotated: %+v", current)
+	}
+	if files := keyFiles(t, dir); len(files) != 2 {
+		t.Fatalf("key files = %v, want previous and current", files)
+	}
+	if err := verify(token); err != nil {
+		t.Fatalf("token of previous key rejected during retention: %v", err)
+	}
+
+	// new tokens are signed by the current key
+	newToken, err := Sign(jwt.MapClaims{"id": "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != current.ID {
+		t.Fatalf("new token kid = %v, want %s", parsed.Header["kid"], current.ID)
+	}
+
+	// after the retention window the previous key is deleted
+	current.CreatedAt = time.Now().Add(-31 * time.Minute)
+	if err := Rotate(time.Hour, 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if Current() != current {
+		t.Fatal("key rotated before max age")
+	}
+	if files := keyFiles(t, dir); len(files) != 1 || files[0] != current.ID {
+		t.Fatalf("key files = %v, want only %s", files, current.ID)
+	}
+	if err := verify(token); err == nil {
+		t.Fatal("token of deleted key accepted")
+	}
+	if err := verify(newToken); err != nil {
+		t.Fatalf("token of current key rejected: %v", err)
+	}
+
+	// deleted keys are not loaded again
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	keysLock.RLock()
+	loaded := len(keys)
+	keysLock.RUnlock()
+	if loaded != 1 || Current().ID != current.ID {
+		t.Fatalf("loaded %d keys, current %s", loaded, Current().ID)
+	}
+}
+
+func TestInitAlgorithmChange(t *testing.T) {
+	dir := useKeysDir(t, AlgHS256)
+	previous := Current()
+	token, err := Sign(jwt.MapClaims{"id": "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same algorithm, the saved key is used
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	if Current().ID != previous.ID {
+		t.Fatal("new key created without algorithm change")
+	}
+
+	// changed algorithm, a new key is created and the previous one still verifies its tokens
+	configuration.Config.JWTSigningAlg = AlgEdDSA
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	current := Current()
+	if current.ID == previous.ID || current.Alg != AlgEdDSA {
+		t.Fatalf("current key = %s %s, want a new EdDSA key", current.ID, current.Alg)
+	}
+	if files := keyFiles(t, dir); len(files) != 2 {
+		t.Fatalf("key files = %v, want previous and current", files)
+	}
+	if err := verify(token); err != nil {
+		t.Fatalf("token of previous key rejected: %v", err)
+	}
+
+	// unsupported algorithms are refused
+	configuration.Config.JWTSigningAlg = "none"
+	if err := Init(); err == nil {
+		t.Fatal("unsupported algorithm accepted")
+	}
+}
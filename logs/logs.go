@@ -10,16 +10,224 @@
 package logs
 
 import (
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var Logs *log.Logger
+// log levels, messages below the current level are discarded
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// Logger writes messages in the form "[LEVEL][TAG] message", the level and the tag of the prefix set
+// severity and facility of syslog messages. Messages without level are logged as info
+type Logger struct {
+	name   string
+	level  atomic.Int32
+	format string
+	syslog *syslogWriter
+
+	lock sync.Mutex
+}
+
+var Logs *Logger
 
 func Init(name string) {
-	// init syslog writer
-	logger := log.New(os.Stderr, name+" ", log.Ldate|log.Ltime|log.Lshortfile)
+	// log to stderr until Configure is called
+	logger := &Logger{name: name, format: FormatText}
+	logger.level.Store(LevelInfo)
 
-	// assign writer to Logs var
+	// assign logger to Logs var
 	Logs = logger
 }
+
+// Configure sets level and format and sends messages to syslog, if address is not empty: "local" for
+// the local socket, udp://host:port or tcp://host:port. Auth messages use authFacility
+func Configure(level string, format string, address string, facility string, authFacility string) error {
+	if err := Logs.SetLevel(level); err != nil {
+		return err
+	}
+	if format != FormatText && format != FormatJSON {
+		return errors.New("unsupported log format " + format)
+	}
+
+	var syslog *syslogWriter
+	if address != "" {
+		var err error
+		if syslog, err = newSyslogWriter(address, Logs.name, facility, authFacility); err != nil {
+			return err
+		}
+	}
+
+	Logs.lock.Lock()
+	if Logs.syslog != nil {
+		Logs.syslog.close()
+	}
+	Logs.format = format
+	Logs.syslog = syslog
+	Logs.lock.Unlock()
+	return nil
+}
+
+// ParseLevel returns the level by name
+func ParseLevel(name string) (int, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return 0, errors.New("unsupported log level " + name)
+}
+
+// SetLevel changes the level at runtime
+func (l *Logger) SetLevel(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	l.level.Store(int32(level))
+	return nil
+}
+
+// Level returns the name of the current level
+func (l *Logger) Level() string {
+	return levelNames[l.level.Load()]
+}
+
+// message is a parsed log line
+type message struct {
+	level    int
+	severity string
+	tag      string
+	text     string
+	line     string
+	caller   string
+	time     time.Time
+}
+
+// parse reads level and tag from the prefix, e.g. [ERR][AUTH]
+func parse(line string) message {
+	m := message{level: LevelInfo, severity: "INFO", line: line, text: line}
+
+	rest := line
+	tags := []string{}
+	for len(tags) < 2 && strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			break
+		}
+		tags = append(tags, rest[1:end])
+		rest = rest[end+1:]
+	}
+	if len(tags) == 0 {
+		return m
+	}
+
+	switch tags[0] {
+	case "DEBUG":
+		m.level = LevelDebug
+	case "INFO":
+		m.level = LevelInfo
+	case "WARN", "WARNING":
+		m.level = LevelWarn
+	case "ERR", "ERROR", "CRITICAL":
+		m.level = LevelError
+	default:
+		// not a level, e.g. a bracket inside the message
+		return m
+	}
+	m.severity = tags[0]
+	if len(tags) > 1 {
+		m.tag = tags[1]
+	}
+	m.text = strings.TrimSpace(rest)
+	return m
+}
+
+// Println logs the message like log.Println, if its level is enabled
+func (l *Logger) Println(v ...interface{}) {
+	m := parse(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+	if int32(m.level) < l.level.Load() {
+		return
+	}
+	m.time = time.Now()
+	if _, file, line, ok := runtime.Caller(1); ok {
+		m.caller = filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+
+	// queue for syslog, falling back to stderr when the queue is full
+	l.lock.Lock()
+	queued := l.syslog != nil && l.syslog.send(syslogEntry{msg: l.syslog.format(m, l.format), fallback: l.formatStderr(m)})
+	if !queued {
+		fmt.Fprintln(os.Stderr, l.formatStderr(m))
+	}
+	l.lock.Unlock()
+
+	// critical messages usually precede the exit of the process
+	if queued && m.severity == "CRITICAL" {
+		l.Flush()
+	}
+}
+
+// Flush waits until the messages logged before are sent to syslog, at most a few seconds
+func (l *Logger) Flush() {
+	l.lock.Lock()
+	syslog := l.syslog
+	l.lock.Unlock()
+	if syslog == nil {
+		return
+	}
+
+	// wait without the lock, messages logged meanwhile go to stderr when the queue is full.
+	// A writer replaced by Configure stops after sending its queue
+	done := syslog.mark()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-syslog.stopped:
+	case <-time.After(syslogTimeout):
+	}
+}
+
+// formatStderr returns the line written to stderr
+func (l *Logger) formatStderr(m message) string {
+	if l.format == FormatJSON {
+		return formatJSON(l.name, m)
+	}
+	return l.name + " " + m.time.Format("2006/01/02 15:04:05") + " " + m.caller + ": " + m.line
+}
+
+// formatJSON returns the message as a JSON object
+func formatJSON(name string, m message) string {
+	out, _ := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		App     string    `json:"app"`
+		Level   string    `json:"level"`
+		Tag     string    `json:"tag,omitempty"`
+		Message string    `json:"message"`
+		Caller  string    `json:"caller"`
+	}{m.time, name, levelNames[m.level], m.tag, m.text, m.caller})
+	return string(out)
+}
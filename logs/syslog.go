@@ -0,0 +1,276 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogTimeout limits connection and write to the syslog server
+const syslogTimeout = 5 * time.Second
+
+// syslogQueueSize is the number of messages waiting to be sent, when it is full messages go to stderr
+const syslogQueueSize = 1024
+
+// the connection is retried after errors waiting a backoff, doubled at every failure
+const (
+	syslogBackoffMin = time.Second
+	syslogBackoffMax = time.Minute
+)
+
+// errSyslogBackoff is returned while waiting to connect again
+var errSyslogBackoff = errors.New("syslog server not reachable")
+
+// local syslog sockets, the first one existing is used
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// facilities by name, RFC 5424 section 6.2.1
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// authTags are the tags of authentication and authorization messages, sent with the auth facility
+var authTags = map[string]bool{"AUTH": true, "2FA": true, "OIDC": true, "RBAC": true, "APIKEYS": true}
+
+// syslogEntry is a queued message with the line written to stderr when it cannot be sent, entries
+// with done set are closed when the previous messages are sent
+type syslogEntry struct {
+	msg      string
+	fallback string
+	done     chan struct{}
+}
+
+// syslogWriter sends RFC 5424 messages to the local socket or to a remote server, reconnecting after errors.
+// Messages are queued and sent by a goroutine, so logging never waits for the server
+type syslogWriter struct {
+	network      string
+	address      string
+	app          string
+	hostname     string
+	facility     int
+	authFacility int
+
+	// the queue is never closed, marks may be queued while the writer is replaced: closing tells the
+	// goroutine to send the queued messages and stop, then stopped is closed
+	queue    chan syslogEntry
+	closing  chan struct{}
+	stopped  chan struct{}
+	dropping bool
+
+	// used only by the sending goroutine
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+}
+
+func newSyslogWriter(address string, app string, facility string, authFacility string) (*syslogWriter, error) {
+	w := &syslogWriter{app: app, hostname: "-"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		w.hostname = hostname
+	}
+
+	var ok bool
+	if w.facility, ok = facilities[facility]; !ok {
+		return nil, errors.New("unsupported syslog facility " + facility)
+	}
+	if w.authFacility, ok = facilities[authFacility]; !ok {
+		return nil, errors.New("unsupported syslog facility " + authFacility)
+	}
+
+	// parse address
+	switch {
+	case address == "local":
+		for _, socket := range syslogSockets {
+			if _, err := os.Stat(socket); err == nil {
+				w.network, w.address = "unixgram", socket
+				break
+			}
+		}
+		if w.address == "" {
+			return nil, errors.New("local syslog socket not found")
+		}
+	case strings.HasPrefix(address, "udp://"):
+		w.network, w.address = "udp", strings.TrimPrefix(address, "udp://")
+	case strings.HasPrefix(address, "tcp://"):
+		w.network, w.address = "tcp", strings.TrimPrefix(address, "tcp://")
+	default:
+		return nil, errors.New("unsupported syslog address " + address + ", use local, udp://host:port or tcp://host:port")
+	}
+
+	// a server not reachable is connected again after a backoff, meanwhile messages go to stderr
+	w.queue = make(chan syslogEntry, syslogQueueSize)
+	w.closing = make(chan struct{})
+	w.stopped = make(chan struct{})
+	go w.run()
+	return w, nil
+}
+
+// run sends the queued messages until the writer is closed, then the ones still queued
+func (w *syslogWriter) run() {
+	defer close(w.stopped)
+	defer func() {
+		if w.conn != nil {
+			w.conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case entry := <-w.queue:
+			w.handle(entry)
+		case <-w.closing:
+			for {
+				select {
+				case entry := <-w.queue:
+					w.handle(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// handle sends a queued message, writing it to stderr on errors, or closes a mark
+func (w *syslogWriter) handle(entry syslogEntry) {
+	if entry.done != nil {
+		close(entry.done)
+		return
+	}
+	if err := w.write(entry.msg); err != nil {
+		if !errors.Is(err, errSyslogBackoff) {
+			fmt.Fprintln(os.Stderr, w.app+" syslog error: "+err.Error())
+		}
+		fmt.Fprintln(os.Stderr, entry.fallback)
+	}
+}
+
+// send queues the message without waiting, it returns false when the queue is full
+func (w *syslogWriter) send(entry syslogEntry) bool {
+	select {
+	case w.queue <- entry:
+		w.dropping = false
+		return true
+	default:
+		if !w.dropping {
+			fmt.Fprintln(os.Stderr, w.app+" syslog error: queue full, messages are written to stderr")
+		}
+		w.dropping = true
+		return false
+	}
+}
+
+// mark queues an entry closed once the messages before it are sent, nil if the queue stays full.
+// It can wait, so it must be called without holding the lock of the logger
+func (w *syslogWriter) mark() chan struct{} {
+	done := make(chan struct{})
+	select {
+	case w.queue <- syslogEntry{done: done}:
+		return done
+	case <-w.closing:
+		// the queued messages are sent before stopping
+		return w.stopped
+	case <-time.After(syslogTimeout):
+		return nil
+	}
+}
+
+// close stops the sending goroutine once the queued messages are sent, it must be called once
+func (w *syslogWriter) close() {
+	close(w.closing)
+}
+
+// connect opens the connection, falling back to stream sockets for local daemons not using datagrams
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, syslogTimeout)
+	if err != nil && w.network == "unixgram" {
+		if conn, err = net.DialTimeout("unix", w.address, syslogTimeout); err == nil {
+			w.network = "unix"
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// severity returns the RFC 5424 severity of the message
+func severity(m message) int {
+	switch m.severity {
+	case "CRITICAL":
+		return 2
+	case "ERR", "ERROR":
+		return 3
+	case "WARN", "WARNING":
+		return 4
+	case "DEBUG":
+		return 7
+	}
+	return 6
+}
+
+// format returns the RFC 5424 message, e.g.
+// <38>1 2025-05-24T14:04:03.000000+02:00 fw nethsecurity_api 1234 AUTH - [INFO][AUTH] authentication success...
+func (w *syslogWriter) format(m message, format string) string {
+	facility := w.facility
+	if authTags[m.tag] {
+		facility = w.authFacility
+	}
+	msgID := m.tag
+	if msgID == "" || strings.ContainsAny(msgID, " =]\"") {
+		msgID = "-"
+	}
+	text := m.line
+	if format == FormatJSON {
+		text = formatJSON(w.app, m)
+	}
+
+	return "<" + strconv.Itoa(facility*8+severity(m)) + ">1 " + m.time.Format("2006-01-02T15:04:05.000000Z07:00") + " " +
+		w.hostname + " " + w.app + " " + strconv.Itoa(os.Getpid()) + " " + msgID + " - " + text
+}
+
+// write sends the message, retrying once with a new connection. After a failed connection the next one
+// is tried only after the backoff
+func (w *syslogWriter) write(msg string) error {
+	// TCP uses octet counting framing of RFC 6587, local stream sockets a newline
+	switch w.network {
+	case "tcp":
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	case "unix":
+		msg += "\n"
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if time.Now().Before(w.retryAt) {
+				return errSyslogBackoff
+			}
+			if err = w.connect(); err != nil {
+				w.backoff = min(max(2*w.backoff, syslogBackoffMin), syslogBackoffMax)
+				w.retryAt = time.Now().Add(w.backoff)
+				return err
+			}
+			w.backoff = 0
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err = w.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
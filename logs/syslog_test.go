@@ -0,0 +1,189 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package logs
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	Init("nethsecurity_api_test")
+	if err := Configure("info", FormatText, "tcp://"+listener.Addr().String(), "daemon", "auth"); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure("info", FormatText, "", "daemon", "auth")
+
+	Logs.Println("[INFO][AUTH] authentication success for local user root")
+	Logs.Println("[ERR][JOBS] job failed")
+	Logs.Println("[DEBUG][JOBS] below the level")
+	Logs.Flush()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	// messages are framed by octet counting
+	for _, want := range []struct{ priority, tail string }{
+		{"<38>1 ", " AUTH - [INFO][AUTH] authentication success for local user root"},
+		{"<27>1 ", " JOBS - [ERR][JOBS] job failed"},
+	} {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("invalid frame length %q", length)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(msg), want.priority) || !strings.HasSuffix(string(msg), want.tail) {
+			t.Fatalf("got %q, want %s...%s", msg, want.priority, want.tail)
+		}
+	}
+}
+
+func TestSyslogNeverBlocks(t *testing.T) {
+	// messages written to stderr are collected in a file
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = previous }()
+
+	// the server never reads, writes block until the deadline
+	client, server := net.Pipe()
+	w := &syslogWriter{
+		network: "udp",
+		app:     "nethsecurity_api_test",
+		queue:   make(chan syslogEntry, 4),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+		conn:    client,
+	}
+	go w.run()
+	logger := &Logger{name: "nethsecurity_api_test", format: FormatText, syslog: w}
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		logger.Println("[INFO][AUTH] message " + strconv.Itoa(i))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("logging waited for syslog: %s", elapsed)
+	}
+
+	// stop the server, queued messages fall back to stderr
+	server.Close()
+	logger.lock.Lock()
+	w.close()
+	logger.lock.Unlock()
+	<-w.stopped
+
+	// no message is lost
+	content, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if !strings.Contains(string(content), "[INFO][AUTH] message "+strconv.Itoa(i)+"\n") {
+			t.Fatalf("message %d not written to stderr:\n%s", i, content)
+		}
+	}
+	if !strings.Contains(string(content), "syslog error: queue full") {
+		t.Fatalf("full queue not reported:\n%s", content)
+	}
+
+	// connection is retried after the backoff
+	if w.backoff != syslogBackoffMin || !w.retryAt.After(time.Now()) {
+		t.Fatalf("got backoff %s until %s", w.backoff, w.retryAt)
+	}
+}
+
+func TestFlushWithoutLock(t *testing.T) {
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = previous }()
+
+	// the server never reads, the first message blocks the sending goroutine and the next one fills the queue
+	client, server := net.Pipe()
+	w := &syslogWriter{
+		network: "udp",
+		app:     "nethsecurity_api_test",
+		queue:   make(chan syslogEntry, 1),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+		conn:    client,
+	}
+	go w.run()
+	logger := &Logger{name: "nethsecurity_api_test", format: FormatText, syslog: w}
+	logger.Println("[INFO][AUTH] first")
+	time.Sleep(50 * time.Millisecond)
+	logger.Println("[INFO][AUTH] second")
+
+	// flush waits for a free slot of the queue
+	flushed := make(chan struct{})
+	go func() {
+		logger.Flush()
+		close(flushed)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// meanwhile messages are logged without waiting
+	start := time.Now()
+	logger.Println("[INFO][AUTH] third")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("logging waited for flush: %s", elapsed)
+	}
+
+	// the writer is replaced while the flush is pending, like Configure does
+	logger.lock.Lock()
+	logger.syslog.close()
+	logger.syslog = nil
+	logger.lock.Unlock()
+	server.Close()
+
+	select {
+	case <-flushed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("flush did not end after the writer stopped")
+	}
+	<-w.stopped
+
+	content, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{"first", "second", "third"} {
+		if !strings.Contains(string(content), "[INFO][AUTH] "+message+"\n") {
+			t.Fatalf("message %s not written to stderr:\n%s", message, content)
+		}
+	}
+}
@@ -10,21 +10,38 @@
 package main
 
 import (
-	"github.com/NethServer/nethsecurity-api/sudo"
+	"context"
+	"crypto/tls"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/sudo"
 
 	"github.com/fatih/structs"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
+	"golang.org/x/net/http2"
 
+	"github.com/NethServer/nethsecurity-api/account"
+	"github.com/NethServer/nethsecurity-api/audit"
 	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/keyring"
 	"github.com/NethServer/nethsecurity-api/logs"
 	"github.com/NethServer/nethsecurity-api/methods"
 	"github.com/NethServer/nethsecurity-api/middleware"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/oidc"
 	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/server"
+	"github.com/NethServer/nethsecurity-api/store"
 )
 
 // @title NethSecurity StandAlone API Server
@@ -42,12 +59,64 @@ import (
 // @BasePath /api
 
 func main() {
-	// init logs with syslog
+	// init logs, on stderr until configured
 	logs.Init("nethsecurity_api")
 
 	// init configuration
 	configuration.Init()
 
+	// set log level, format and syslog destination
+	if err := logs.Configure(configuration.Config.LogLevel, configuration.Config.LogFormat, configuration.Config.LogSyslog, configuration.Config.LogSyslogFacility, configuration.Config.LogSyslogAuthFacility); err != nil {
+		logs.Logs.Println("[CRITICAL][ENV] failed to configure logs: " + err.Error())
+		os.Exit(1)
+	}
+
+	// init token store
+	if err := store.Init(); err != nil {
+		logs.Logs.Println("[CRITICAL][JWT] failed to open token store " + configuration.Config.TokensDB + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	// open audit log
+	if err := audit.Init(); err != nil {
+		logs.Logs.Println("[CRITICAL][AUDIT] failed to open audit file " + configuration.Config.AuditFile + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	// load JWT signing keys
+	if err := keyring.Init(); err != nil {
+		logs.Logs.Println("[CRITICAL][JWT] failed to load signing keys " + configuration.Config.JWTKeysDir + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	// load API keys
+	if err := methods.LoadAPIKeys(); err != nil {
+		logs.Logs.Println("[CRITICAL][APIKEYS] failed to read api keys " + configuration.Config.APIKeysFile + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	// load client certificates mapping and revocation list
+	if err := methods.LoadClientCerts(); err != nil {
+		logs.Logs.Println("[CRITICAL][TLS] failed to load client certificates " + configuration.Config.ClientCertsFile + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	// reload configuration files on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := configuration.Reload(); err != nil {
+				logs.Logs.Println("[ERR][ENV] configuration reload failed, keeping previous one: " + err.Error())
+			} else {
+				logs.Logs.Println("[INFO][ENV] configuration reloaded")
+			}
+			if err := methods.LoadClientCerts(); err != nil {
+				logs.Logs.Println("[ERR][TLS] client certificates reload failed, keeping previous ones: " + err.Error())
+			}
+		}
+	}()
+
 	// disable log to stdout when running in release mode
 	if gin.Mode() == gin.ReleaseMode {
 		gin.DefaultWriter = io.Discard
@@ -56,8 +125,18 @@ func main() {
 	// init routers
 	router := gin.Default()
 
-	// add default compression
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	// read client IP from proxy headers only when sent by a trusted proxy
+	if err := router.SetTrustedProxies(configuration.Config.TrustedProxies); err != nil {
+		logs.Logs.Println("[CRITICAL][ENV] invalid TRUSTED_PROXIES: " + err.Error())
+		os.Exit(1)
+	}
+
+	// save the connection controller before gzip wraps the writer, routes with long requests or
+	// responses extend their deadlines through it once the client is authenticated
+	router.Use(middleware.ResponseControllerMiddleware())
+
+	// add default compression, except for event streams that must be flushed line by line
+	router.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api/ubus/stream"})))
 
 	// cors configuration only in debug mode GIN_MODE=debug (default)
 	if gin.Mode() == gin.DebugMode {
@@ -68,36 +147,92 @@ func main() {
 		router.Use(cors.New(corsConf))
 	}
 
+	// public signing keys
+	router.GET("/.well-known/jwks.json", middleware.JWKS)
+
 	// define api group
 	api := router.Group("/api")
 
 	// define login and logout endpoint
-	api.POST("/login", middleware.InstanceJWT().LoginHandler)
-	api.POST("/logout", middleware.InstanceJWT().LogoutHandler)
+	api.POST("/login", middleware.AuditMiddleware(models.AuditLogin), middleware.LoginLockoutMiddleware(), middleware.LoginHandler)
+	api.POST("/logout", middleware.AuditMiddleware(models.AuditLogout), middleware.InstanceJWT().LogoutHandler)
+
+	// OIDC single sign-on
+	api.GET("/oidc/login", oidc.Login)
+	api.GET("/oidc/callback", middleware.AuditMiddleware(models.AuditLogin), oidc.Callback)
 
 	// 2FA APIs
-	api.POST("/2fa/otp-verify", methods.OTPVerify)
+	api.POST("/2fa/otp-verify", middleware.AuditMiddleware(models.AuditLogin), methods.OTPVerify, middleware.TwoFactorTokenHandler)
+	api.POST("/2fa/webauthn/login/begin", methods.WebAuthnLoginBegin)
+	api.POST("/2fa/webauthn/login/finish", middleware.AuditMiddleware(models.AuditLogin), methods.WebAuthnLoginFinish, middleware.TwoFactorTokenHandler)
 
 	// define JWT middleware
-	authGroup := api.Group("/", middleware.InstanceJWT().MiddlewareFunc())
+	authGroup := api.Group("/", middleware.AuthMiddleware(), middleware.PasswordChangeMiddleware())
 	// allow user to request sudo mode
-	authGroup.POST("/sudo", sudo.EnableSudo)
+	authGroup.POST("/sudo", middleware.AuditMiddleware(models.AuditSudo), sudo.EnableSudo)
 	// refresh handler
-	authGroup.GET("/refresh", middleware.InstanceJWT().RefreshHandler)
+	authGroup.GET("/refresh", middleware.RefreshHandler)
+
+	// calls can last until UBUS_TIMEOUT, batches until all their calls end
+	callTimeout := time.Duration(configuration.Config.UBusTimeout) * time.Second
+	longTimeout := callTimeout + server.WriteTimeout
 
 	// ubus wrapper
-	authGroup.POST("/ubus/call", middleware.SudoUbusCallsMiddleware(), methods.UBusCallAction)
+	authGroup.POST("/ubus/call", middleware.DeadlineMiddleware(longTimeout), middleware.AuditMiddleware(models.AuditUBus), middleware.RoleUbusCallsMiddleware(), middleware.SudoUbusCallsMiddleware(), methods.UBusCallAction)
+	authGroup.POST("/ubus/batch", middleware.BatchDeadlineMiddleware(server.WriteTimeout, callTimeout), middleware.AuditMiddleware(models.AuditUBus), methods.UBusBatchAction)
+	authGroup.POST("/ubus/stream", middleware.DeadlineMiddleware(longTimeout), middleware.AuditMiddleware(models.AuditUBus), middleware.RoleUbusCallsMiddleware(), middleware.SudoUbusCallsMiddleware(), methods.UBusStreamAction)
+
+	// jobs APIs
+	authGroup.POST("/jobs", middleware.DeadlineMiddleware(longTimeout), middleware.AuditMiddleware(models.AuditUBus), middleware.RoleUbusCallsMiddleware(), middleware.SudoUbusCallsMiddleware(), methods.CreateJob)
+	authGroup.GET("/jobs", middleware.DeadlineMiddleware(longTimeout), methods.ListJobs)
+	authGroup.GET("/jobs/:id", middleware.DeadlineMiddleware(longTimeout), methods.GetJob)
+	authGroup.DELETE("/jobs/:id", middleware.DeadlineMiddleware(longTimeout), middleware.AuditMiddleware(models.AuditUBus), methods.DeleteJob)
+
+	// sessions APIs
+	authGroup.GET("/sessions", methods.ListSessions)
+	authGroup.DELETE("/sessions", middleware.AuditMiddleware(models.AuditSession), methods.DeleteSessions)
+	authGroup.DELETE("/sessions/:id", middleware.AuditMiddleware(models.AuditSession), methods.DeleteSession)
+
+	// account APIs
+	authGroup.POST("/account/password", middleware.AuditMiddleware(models.AuditPassword), middleware.SudoModeMiddleware(), account.ChangePassword)
+	authGroup.POST("/account/password/expire", middleware.AuditMiddleware(models.AuditPassword), middleware.RoleRoutesMiddleware(), middleware.SudoModeMiddleware(), account.ExpirePassword)
+
+	// lockouts APIs
+	lockoutsGroup := authGroup.Group("/lockouts", middleware.RoleRoutesMiddleware())
+	lockoutsGroup.GET("", methods.ListLockouts)
+	lockoutsGroup.DELETE("/users/:username", middleware.AuditMiddleware(models.AuditLockout), middleware.SudoModeMiddleware(), methods.UnlockUser)
+	lockoutsGroup.DELETE("/ips/:ip", middleware.AuditMiddleware(models.AuditLockout), middleware.SudoModeMiddleware(), methods.UnlockIP)
+
+	// API keys APIs
+	apiKeysGroup := authGroup.Group("/api-keys", middleware.RoleRoutesMiddleware())
+	apiKeysGroup.GET("", methods.ListAPIKeys)
+	apiKeysGroup.POST("", middleware.AuditMiddleware(models.AuditAPIKey), middleware.SudoModeMiddleware(), methods.CreateAPIKey)
+	apiKeysGroup.DELETE("/:id", middleware.AuditMiddleware(models.AuditAPIKey), middleware.SudoModeMiddleware(), methods.DeleteAPIKey)
 
 	// 2FA APIs
 	authGroup.GET("/2fa", methods.Get2FAStatus)
-	authGroup.DELETE("/2fa", middleware.SudoModeMiddleware(), methods.Del2FAStatus)
-	authGroup.GET("/2fa/recovery-codes", middleware.SudoModeMiddleware(), methods.Get2FARecoveryCodes)
-	authGroup.GET("/2fa/qr-code", middleware.SudoModeMiddleware(), methods.QRCode)
+	authGroup.DELETE("/2fa", middleware.AuditMiddleware(models.AuditTwoFactor), middleware.SudoModeMiddleware(), methods.Del2FAStatus)
+	authGroup.GET("/2fa/recovery-codes", middleware.AuditMiddleware(models.AuditTwoFactor), middleware.SudoModeMiddleware(), methods.Get2FARecoveryCodes)
+	authGroup.GET("/2fa/qr-code", middleware.AuditMiddleware(models.AuditTwoFactor), middleware.SudoModeMiddleware(), methods.QRCode)
+	authGroup.POST("/2fa/webauthn/register/begin", middleware.AuditMiddleware(models.AuditTwoFactor), middleware.SudoModeMiddleware(), methods.WebAuthnRegisterBegin)
+	authGroup.POST("/2fa/webauthn/register/finish", middleware.AuditMiddleware(models.AuditTwoFactor), middleware.SudoModeMiddleware(), methods.WebAuthnRegisterFinish)
+	authGroup.GET("/2fa/webauthn/credentials", methods.WebAuthnListCredentials)
+	authGroup.PUT("/2fa/webauthn/credentials/:id", middleware.AuditMiddleware(models.AuditTwoFactor), methods.WebAuthnRenameCredential)
+	authGroup.DELETE("/2fa/webauthn/credentials/:id", middleware.AuditMiddleware(models.AuditTwoFactor), middleware.SudoModeMiddleware(), methods.WebAuthnDeleteCredential)
+
+	// audit APIs
+	authGroup.GET("/audit", middleware.RoleRoutesMiddleware(), middleware.SudoModeMiddleware(), methods.ListAuditEvents)
+
+	// logs APIs
+	logsGroup := authGroup.Group("/logs", middleware.RoleRoutesMiddleware())
+	logsGroup.GET("/level", methods.GetLogLevel)
+	logsGroup.PUT("/level", middleware.AuditMiddleware(models.AuditLogLevel), middleware.SudoModeMiddleware(), methods.SetLogLevel)
 
 	// files handler
-	authGroup.GET("/files/:filename", methods.DownloadFile)
-	authGroup.POST("/files", methods.UploadFile)
-	authGroup.DELETE("/files/:filename", methods.DeleteFile)
+	filesGroup := authGroup.Group("/files", middleware.RoleRoutesMiddleware(), middleware.DeadlineMiddleware(longTimeout))
+	filesGroup.GET("/:filename", methods.DownloadFile)
+	filesGroup.POST("", middleware.AuditMiddleware(models.AuditFile), methods.UploadFile)
+	filesGroup.DELETE("/:filename", middleware.AuditMiddleware(models.AuditFile), methods.DeleteFile)
 
 	// handle missing endpoint
 	router.NoRoute(func(c *gin.Context) {
@@ -108,14 +243,122 @@ func main() {
 		}))
 	})
 
-	// run expired token cleanup, on startup
+	// move tokens of previous versions to token store and run expired token cleanup, on startup
+	methods.MigrateTokenFiles()
 	methods.DeleteExpiredTokens()
+	middleware.RotateSigningKeys()
 
 	// create cron to run daily
 	c := cron.New()
 	c.AddFunc("@daily", methods.DeleteExpiredTokens)
+	c.AddFunc("@hourly", middleware.RotateSigningKeys)
+	c.AddFunc("@every 1m", methods.DeleteExpiredJobs)
+	c.AddFunc("@every 1m", methods.DeleteExpiredLockouts)
 	c.Start()
 
-	// run server
-	router.Run(configuration.Config.ListenAddress)
+	// open listener, TCP address, unix socket or passed by the service manager
+	listener, err := server.Listen(configuration.Config.ListenAddress)
+	if err != nil {
+		logs.Logs.Println("[CRITICAL][SERVER] failed to listen on " + configuration.Config.ListenAddress + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	// requests contexts are cancelled when draining takes too long, killing their child processes
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Handler:           server.Handler(listener, router),
+		BaseContext:       func(net.Listener) context.Context { return requestsCtx },
+		ReadHeaderTimeout: server.ReadHeaderTimeout,
+		ReadTimeout:       server.ReadTimeout,
+		WriteTimeout:      server.WriteTimeout,
+		IdleTimeout:       server.IdleTimeout,
+	}
+
+	// use TLS when a certificate is configured
+	if configuration.Config.TLSCertFile != "" {
+		// the certificate is reloaded when renewed
+		certificate, err := server.LoadCertificate(configuration.Config.TLSCertFile, configuration.Config.TLSKeyFile)
+		if err != nil {
+			logs.Logs.Println("[CRITICAL][TLS] failed to load certificate " + configuration.Config.TLSCertFile + ": " + err.Error())
+			os.Exit(1)
+		}
+		c.AddFunc("@every 1m", certificate.Reload)
+		tlsConfig, err := server.TLSConfig(certificate)
+		if err != nil {
+			logs.Logs.Println("[CRITICAL][TLS] " + err.Error())
+			os.Exit(1)
+		}
+
+		if configuration.Config.TLSClientCAFile != "" {
+			// client certificates are optional, clients without one use tokens
+			pool, err := methods.ClientCAPool()
+			if err != nil {
+				logs.Logs.Println("[CRITICAL][TLS] failed to load client CA " + configuration.Config.TLSClientCAFile + ": " + err.Error())
+				os.Exit(1)
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		httpServer.TLSConfig = tlsConfig
+		if err := http2.ConfigureServer(httpServer, &http2.Server{}); err != nil {
+			logs.Logs.Println("[CRITICAL][TLS] HTTP/2 configuration error: " + err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// run server until SIGTERM or SIGINT
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	serveErr := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			serveErr <- httpServer.ServeTLS(listener, "", "")
+		} else {
+			serveErr <- httpServer.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		logs.Logs.Println("[CRITICAL][SERVER] server error: " + err.Error())
+		os.Exit(1)
+	case sig := <-stop:
+		logs.Logs.Println("[INFO][SERVER] received " + sig.String() + ", shutting down")
+	}
+
+	// stop accepting connections and wait for running requests, then cancel the remaining ones
+	timeout := time.Duration(configuration.Config.ShutdownTimeout) * time.Second
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		logs.Logs.Println("[WARNING][SERVER] requests still running after " + strconv.FormatInt(configuration.Config.ShutdownTimeout, 10) + " seconds, cancelling them")
+		cancelRequests()
+		httpServer.Close()
+	}
+	cancelRequests()
+
+	// cancel background jobs, killing their child processes, and stop cron waiting for running tasks
+	cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), timeout)
+	defer cancelCleanup()
+	if err := methods.CancelJobs(cleanupCtx); err != nil {
+		logs.Logs.Println("[WARNING][JOBS] jobs still running on shutdown: " + err.Error())
+	}
+	select {
+	case <-c.Stop().Done():
+	case <-cleanupCtx.Done():
+		logs.Logs.Println("[WARNING][SERVER] scheduled tasks still running on shutdown")
+	}
+
+	// flush and close audit file
+	if err := audit.Close(); err != nil {
+		logs.Logs.Println("[ERR][AUDIT] failed to close audit file: " + err.Error())
+	}
+
+	// flush and close token store
+	if err := store.Tokens.Close(); err != nil {
+		logs.Logs.Println("[ERR][JWT] failed to close token store: " + err.Error())
+	}
+	logs.Logs.Println("[INFO][SERVER] shutdown complete")
+	logs.Logs.Flush()
 }
@@ -0,0 +1,336 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/utils"
+)
+
+// APIKeyPrefix starts every API key, keys have the form nsk_<id>_<secret>
+const APIKeyPrefix = "nsk_"
+
+// APIKeyRoutes are the routes an API key can reach, ubus calls are further limited by the key rules
+var APIKeyRoutes = []string{
+	"route:/api/ubus/*:POST",
+	"route:/api/jobs:*",
+	"route:/api/jobs/*:*",
+}
+
+var apiKeys = []models.APIKey{}
+var apiKeysLock sync.RWMutex
+
+// LoadAPIKeys reads the API keys file, a missing file means no keys
+func LoadAPIKeys() error {
+	keys := []models.APIKey{}
+
+	content, err := os.ReadFile(configuration.Config.APIKeysFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &keys); err != nil {
+			return err
+		}
+	}
+
+	apiKeysLock.Lock()
+	apiKeys = keys
+	apiKeysLock.Unlock()
+	return nil
+}
+
+// saveAPIKeys writes the API keys file, the caller holds the lock
+func saveAPIKeys() error {
+	content, err := json.Marshal(apiKeys)
+	if err != nil {
+		return err
+	}
+
+	// write a temporary file and move it, to never leave a truncated file
+	if err := os.WriteFile(configuration.Config.APIKeysFile+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(configuration.Config.APIKeysFile+".tmp", configuration.Config.APIKeysFile)
+}
+
+// hashAPIKey returns the hash of the key saved inside the API keys file
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// allowedAPIKeyIP checks the client IP against the addresses and networks of the key, an empty list
+// allows every client
+func allowedAPIKeyIP(allowed []string, clientIP string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAPIKey looks up the key and checks its hash, expiry and client IP, returning an error message
+// when the key is not accepted
+func CheckAPIKey(key string, clientIP string) (models.APIKey, string) {
+	// split nsk_<id>_<secret>
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(parts) != 2 {
+		return models.APIKey{}, "api key malformed"
+	}
+
+	return checkAPIKey(parts[0], clientIP, func(apiKey models.APIKey) bool {
+		return subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashAPIKey(key))) == 1
+	})
+}
+
+// CheckAPIKeyID checks expiry and client IP of a key used by a client certificate, the certificate
+// replaces the key secret
+func CheckAPIKeyID(id string, clientIP string) (models.APIKey, string) {
+	return checkAPIKey(id, clientIP, func(apiKey models.APIKey) bool { return true })
+}
+
+// checkAPIKey looks up the key by id and checks it, returning an error message when not accepted
+func checkAPIKey(id string, clientIP string, verify func(apiKey models.APIKey) bool) (models.APIKey, string) {
+	apiKeysLock.Lock()
+	defer apiKeysLock.Unlock()
+
+	for i := range apiKeys {
+		if apiKeys[i].ID != id {
+			continue
+		}
+		if !verify(apiKeys[i]) {
+			return models.APIKey{}, "api key invalid"
+		}
+		if time.Now().After(apiKeys[i].ExpiresAt) {
+			return models.APIKey{}, "api key expired"
+		}
+		if !allowedAPIKeyIP(apiKeys[i].AllowedIPs, clientIP) {
+			return models.APIKey{}, "api key not allowed from " + clientIP
+		}
+
+		// track last use in memory, it is saved with the next change of the file
+		now := time.Now()
+		apiKeys[i].LastUsedAt = &now
+		return apiKeys[i], ""
+	}
+	return models.APIKey{}, "api key invalid"
+}
+
+// APIKeyClaims returns the claims used by handlers for requests authenticated by an API key
+func APIKeyClaims(apiKey models.APIKey) jwt.MapClaims {
+	actions := []interface{}{}
+	for _, rule := range apiKey.UBus {
+		actions = append(actions, "ubus:"+rule.Path+":"+rule.Method)
+	}
+	for _, route := range APIKeyRoutes {
+		actions = append(actions, route)
+	}
+
+	return jwt.MapClaims{
+		"id":      "api-key:" + apiKey.Name,
+		"api_key": apiKey.ID,
+		"role":    "",
+		"actions": actions,
+		"2fa":     false,
+	}
+}
+
+func CreateAPIKey(c *gin.Context) {
+	// parse request fields
+	var jsonAPIKey models.APIKeyJSON
+	if err := c.ShouldBindBodyWith(&jsonAPIKey, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// check expiry and allowed addresses
+	if !jsonAPIKey.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    "expires_at must be in the future",
+		}))
+		return
+	}
+	for _, entry := range jsonAPIKey.AllowedIPs {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "request fields malformed",
+				Data:    "invalid address in allowed_ips: " + entry,
+			}))
+			return
+		}
+	}
+
+	// get claims from token
+	claims := jwt.ExtractClaims(c)
+
+	// a key can not grant more than its creator
+	actions := ClaimsActions(claims)
+	for _, rule := range jsonAPIKey.UBus {
+		if !utils.CoverAction(actions, "ubus", rule.Path, rule.Method) {
+			c.JSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+				Code:    403,
+				Message: "api key ubus rule not allowed for current role",
+				Data:    rule.Path + " " + rule.Method,
+			}))
+			return
+		}
+	}
+
+	// generate id and secret
+	random := make([]byte, 40)
+	if _, err := rand.Read(random); err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "api key generation error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	id := hex.EncodeToString(random[:8])
+	key := APIKeyPrefix + id + "_" + hex.EncodeToString(random[8:])
+
+	apiKey := models.APIKey{
+		ID:         id,
+		Name:       jsonAPIKey.Name,
+		Hash:       hashAPIKey(key),
+		UBus:       jsonAPIKey.UBus,
+		AllowedIPs: jsonAPIKey.AllowedIPs,
+		ExpiresAt:  jsonAPIKey.ExpiresAt,
+		CreatedBy:  claims["id"].(string),
+		CreatedAt:  time.Now(),
+	}
+
+	apiKeysLock.Lock()
+	apiKeys = append(apiKeys, apiKey)
+	err := saveAPIKeys()
+	if err != nil {
+		apiKeys = apiKeys[:len(apiKeys)-1]
+	}
+	apiKeysLock.Unlock()
+
+	if err != nil {
+		logs.Logs.Println("[ERR][APIKEYS] cannot write api keys file: " + err.Error())
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "api key save error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	logs.Logs.Println("[INFO][APIKEYS] api key " + apiKey.Name + " (" + id + ") created by user " + apiKey.CreatedBy)
+
+	// the key is returned only now, just its hash is saved
+	c.JSON(http.StatusCreated, structs.Map(response.StatusCreated{
+		Code:    201,
+		Message: "api key created",
+		Data:    gin.H{"id": id, "key": key},
+	}))
+}
+
+func ListAPIKeys(c *gin.Context) {
+	apiKeysLock.RLock()
+	list := []models.APIKey{}
+	for _, apiKey := range apiKeys {
+		apiKey.Hash = ""
+		list = append(list, apiKey)
+	}
+	apiKeysLock.RUnlock()
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "api keys list",
+		Data:    list,
+	}))
+}
+
+func DeleteAPIKey(c *gin.Context) {
+	apiKeysLock.Lock()
+	previous := apiKeys
+	keys := []models.APIKey{}
+	for _, apiKey := range apiKeys {
+		if apiKey.ID != c.Param("id") {
+			keys = append(keys, apiKey)
+		}
+	}
+	found := len(keys) != len(previous)
+	var err error
+	if found {
+		apiKeys = keys
+		if err = saveAPIKeys(); err != nil {
+			apiKeys = previous
+		}
+	}
+	apiKeysLock.Unlock()
+
+	if !found {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "api key not found",
+			Data:    "",
+		}))
+		return
+	}
+	if err != nil {
+		logs.Logs.Println("[ERR][APIKEYS] cannot write api keys file: " + err.Error())
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "api key save error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	logs.Logs.Println("[INFO][APIKEYS] api key " + c.Param("id") + " deleted by user " + jwt.ExtractClaims(c)["id"].(string))
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "api key deleted",
+		Data:    "",
+	}))
+}
@@ -0,0 +1,140 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+func TestCheckAPIKeyClientIP(t *testing.T) {
+	const key = APIKeyPrefix + "0011223344556677_secret"
+	apiKeysLock.Lock()
+	previous := apiKeys
+	apiKeys = []models.APIKey{{
+		ID:         "0011223344556677",
+		Name:       "backup",
+		Hash:       hashAPIKey(key),
+		AllowedIPs: []string{"192.0.2.0/24"},
+		ExpiresAt:  time.Now().Add(time.Hour),
+	}}
+	apiKeysLock.Unlock()
+	t.Cleanup(func() {
+		apiKeysLock.Lock()
+		apiKeys = previous
+		apiKeysLock.Unlock()
+	})
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		allowed   bool
+	}{
+		{name: "allowed peer", peer: "192.0.2.10", allowed: true},
+		{name: "other peer", peer: "203.0.113.5"},
+		{name: "spoofed header", peer: "203.0.113.5", forwarded: "192.0.2.10"},
+		{name: "trusted proxy", peer: "127.0.0.1", forwarded: "192.0.2.10", allowed: true},
+		{name: "trusted proxy of other client", peer: "127.0.0.1", forwarded: "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, router := gin.CreateTestContext(httptest.NewRecorder())
+			if err := router.SetTrustedProxies([]string{"127.0.0.1", "::1"}); err != nil {
+				t.Fatal(err)
+			}
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/ubus/call", nil)
+			c.Request.RemoteAddr = tt.peer + ":40000"
+			if tt.forwarded != "" {
+				c.Request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			_, message := CheckAPIKey(key, c.ClientIP())
+			if (message == "") != tt.allowed {
+				t.Errorf("message = %q, allowed %v", message, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKeyActions(t *testing.T) {
+	dir := t.TempDir()
+	previousRoles, previousKeys := configuration.Config.RolesFile, configuration.Config.APIKeysFile
+	configuration.Config.RolesFile = filepath.Join(dir, "roles.json")
+	configuration.Config.APIKeysFile = filepath.Join(dir, "api_keys.json")
+	roles := `{"roles": {"operator": {"ubus": [{"path": "network.interface.*", "method": "status"}, {"path": "luci", "method": "get*"}]}}}`
+	if err := os.WriteFile(configuration.Config.RolesFile, []byte(roles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := configuration.LoadRoles(); err != nil {
+		t.Fatal(err)
+	}
+	apiKeysLock.Lock()
+	previous := apiKeys
+	apiKeysLock.Unlock()
+	t.Cleanup(func() {
+		configuration.Config.RolesFile, configuration.Config.APIKeysFile = previousRoles, previousKeys
+		apiKeysLock.Lock()
+		apiKeys = previous
+		apiKeysLock.Unlock()
+	})
+
+	tests := []struct {
+		name string
+		role string
+		ubus []models.UBusRule
+		code int
+	}{
+		{name: "granted call", role: "operator", ubus: []models.UBusRule{{Path: "network.interface.wan", Method: "status"}}, code: http.StatusCreated},
+		{name: "granted pattern", role: "operator", ubus: []models.UBusRule{{Path: "network.interface.*", Method: "status"}, {Path: "luci", Method: "get?"}}, code: http.StatusCreated},
+		{name: "broader path", role: "operator", ubus: []models.UBusRule{{Path: "network.*", Method: "status"}}, code: http.StatusForbidden},
+		{name: "broader method", role: "operator", ubus: []models.UBusRule{{Path: "network.interface.wan", Method: "*"}}, code: http.StatusForbidden},
+		{name: "wildcard in place of a character", role: "operator", ubus: []models.UBusRule{{Path: "luci", Method: "?et"}}, code: http.StatusForbidden},
+		{name: "one broader rule", role: "operator", ubus: []models.UBusRule{{Path: "luci", Method: "getVersion"}, {Path: "luci", Method: "set*"}}, code: http.StatusForbidden},
+		{name: "admin", role: configuration.AdminRole, ubus: []models.UBusRule{{Path: "*", Method: "*"}}, code: http.StatusCreated},
+		{name: "no role", role: "", ubus: []models.UBusRule{{Path: "network.interface.wan", Method: "status"}}, code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _ := json.Marshal(models.APIKeyJSON{Name: tt.name, UBus: tt.ubus, ExpiresAt: time.Now().Add(time.Hour)})
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/api-keys", strings.NewReader(string(content)))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set("JWT_PAYLOAD", jwt.MapClaims{"id": "alice", "role": tt.role})
+
+			CreateAPIKey(c)
+			if recorder.Code != tt.code {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.code, recorder.Body.String())
+			}
+
+			// refused keys are not saved
+			apiKeysLock.RLock()
+			saved := false
+			for _, apiKey := range apiKeys {
+				saved = saved || apiKey.Name == tt.name
+			}
+			apiKeysLock.RUnlock()
+			if saved != (tt.code == http.StatusCreated) {
+				t.Errorf("key saved = %v with status %d", saved, recorder.Code)
+			}
+		})
+	}
+}
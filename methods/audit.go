@@ -0,0 +1,83 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+)
+
+// maxAuditPerPage is the largest page of audit events
+const maxAuditPerPage = 500
+
+// ListAuditEvents returns the audit events matching the query filters, newest first
+func ListAuditEvents(c *gin.Context) {
+	// parse filters
+	filter := models.AuditFilter{
+		Type:    c.Query("type"),
+		User:    c.Query("user"),
+		IP:      c.Query("ip"),
+		Result:  c.Query("result"),
+		Page:    1,
+		PerPage: 50,
+	}
+	var err error
+	if value := c.Query("since"); value != "" && err == nil {
+		filter.Since, err = time.Parse(time.RFC3339, value)
+	}
+	if value := c.Query("until"); value != "" && err == nil {
+		filter.Until, err = time.Parse(time.RFC3339, value)
+	}
+	if value := c.Query("page"); value != "" && err == nil {
+		filter.Page, err = strconv.Atoi(value)
+	}
+	if value := c.Query("per_page"); value != "" && err == nil {
+		filter.PerPage, err = strconv.Atoi(value)
+	}
+	if err == nil && (filter.Page < 1 || filter.PerPage < 1 || filter.PerPage > maxAuditPerPage) {
+		err = strconv.ErrRange
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "invalid audit filters",
+			Data:    "since and until must be RFC 3339 times, page at least 1, per_page between 1 and " + strconv.Itoa(maxAuditPerPage),
+		}))
+		return
+	}
+
+	// read events
+	events, total, err := audit.Query(filter)
+	if err != nil {
+		logs.Logs.Println("[ERR][AUDIT] cannot read audit events: " + err.Error())
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "audit events read error",
+			Data:    nil,
+		}))
+		return
+	}
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "audit events",
+		Data: models.AuditPage{
+			Events:  events,
+			Total:   total,
+			Page:    filter.Page,
+			PerPage: filter.PerPage,
+		},
+	}))
+}
@@ -10,16 +10,18 @@
 package methods
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"encoding/hex"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Jeffail/gabs/v2"
 	jwt "github.com/appleboy/gin-jwt/v2"
@@ -27,32 +29,43 @@ import (
 	"github.com/fatih/structs"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
-	jwtl "github.com/golang-jwt/jwt"
+	jwtl "github.com/golang-jwt/jwt/v4"
 
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/authenticator"
 	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/keyring"
 	"github.com/NethServer/nethsecurity-api/logs"
 	"github.com/NethServer/nethsecurity-api/models"
 	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/store"
 	"github.com/NethServer/nethsecurity-api/utils"
 )
 
-func CheckAuthentication(username string, password string) error {
-	// define login object
-	login := models.UserLogin{
-		Username: username,
-		Password: password,
-		Timeout:  1,
-	}
-	jsonLogin, _ := json.Marshal(login)
+// CheckAuthentication checks the credentials with the authentication backends, returning the identity
+// of the user and the backend that accepted them
+func CheckAuthentication(username string, password string) (models.AuthIdentity, error) {
+	return authenticator.Authenticate(username, password)
+}
 
-	// execute login command on ubus
-	_, err := exec.Command("/bin/ubus", "call", "session", "login", string(jsonLogin)).Output()
+func CheckOTP(username string, otp string) bool {
+	// get secret for the user
+	secret := GetUserSecret(username)
+	if len(secret) == 0 {
+		return false
+	}
 
-	if err != nil {
-		return err
+	// set OTP configuration
+	otpc := &dgoogauth.OTPConfig{
+		Secret:      secret,
+		WindowSize:  3,
+		HotpCounter: 0,
 	}
 
-	return nil
+	// verifiy OTP
+	result, err := otpc.Authenticate(otp)
+	return err == nil && result
 }
 
 func OTPVerify(c *gin.Context) {
@@ -67,13 +80,35 @@ func OTPVerify(c *gin.Context) {
 		return
 	}
 
-	// verify JWT
-	if !ValidateAuth(jsonOTP.Token, false) {
-		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
-			Code:    400,
-			Message: "JWT token invalid",
-			Data:    "",
-		}))
+	// a pending login sends its challenge, enabling 2FA sends the token of the current session
+	if jsonOTP.Challenge != "" {
+		username, ok := GetTwoFactorChallenge(c, jsonOTP.Challenge)
+		if !ok {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "2FA challenge invalid or expired",
+				Data:    "",
+			}))
+			return
+		}
+		jsonOTP.Username = username
+	} else {
+		// verify JWT and its owner, the second factor is being enabled
+		audit.SetType(c, models.AuditTwoFactor)
+		claims, err := parseUnverifiedClaims(jsonOTP.Token)
+		if !ValidateAuth(jsonOTP.Token, true) || err != nil || claims["id"] != jsonOTP.Username {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "JWT token invalid",
+				Data:    "",
+			}))
+			return
+		}
+		audit.SetUser(c, jsonOTP.Username)
+	}
+
+	// refuse attempts of locked users and clients
+	if !CheckAuthLockout(c, jsonOTP.Username) {
 		return
 	}
 
@@ -90,21 +125,18 @@ func OTPVerify(c *gin.Context) {
 		return
 	}
 
-	// set OTP configuration
-	otpc := &dgoogauth.OTPConfig{
-		Secret:      secret,
-		WindowSize:  3,
-		HotpCounter: 0,
-	}
-
 	// verifiy OTP
-	result, err := otpc.Authenticate(jsonOTP.OTP)
-	if err != nil || !result {
+	if !CheckOTP(jsonOTP.Username, jsonOTP.OTP) {
 
 		// check if OTP is a recovery code
 		recoveryCodes := GetRecoveryCodes(jsonOTP.Username)
 
 		if !utils.Contains(jsonOTP.OTP, recoveryCodes) {
+			RegisterAuthFailure(jsonOTP.Username, c.ClientIP())
+			if jsonOTP.Challenge != "" {
+				FailTwoFactorChallenge(jsonOTP.Challenge)
+			}
+
 			// compose validation error
 			jsonParsed, _ := gabs.ParseJSON([]byte(`{
 				"validation": {
@@ -142,21 +174,27 @@ func OTPVerify(c *gin.Context) {
 
 	}
 
+	// reset failed attempts
+	RegisterAuthSuccess(jsonOTP.Username)
+
+	// complete pending login, the session token is issued by the next handler
+	if jsonOTP.Challenge != "" {
+		if !CompleteTwoFactorChallenge(c, jsonOTP.Challenge) {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "2FA challenge invalid or expired",
+				Data:    "",
+			}))
+		}
+		return
+	}
+
 	// check if 2FA was disabled
-	status, _ := os.ReadFile(configuration.Config.SecretsDir + "/" + jsonOTP.Username + "/status")
-	statusOld := strings.TrimSpace(string(status[:]))
+	statusOld, _ := GetUserStatus(jsonOTP.Username)
 
 	// then clean all previous tokens
 	if statusOld == "0" || statusOld == "" {
-		// open file
-		f, _ := os.OpenFile(configuration.Config.TokensDir+"/"+jsonOTP.Username, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-		defer f.Close()
-
-		// write file with tokens
-		_, err := f.WriteString("")
-
-		// check error
-		if err != nil {
+		if err := store.Tokens.DeleteUser(jsonOTP.Username); err != nil {
 			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 				Code:    400,
 				Message: "clean previous tokens error",
@@ -167,7 +205,7 @@ func OTPVerify(c *gin.Context) {
 	}
 
 	// set auth token to valid
-	if !SetTokenValidation(jsonOTP.Username, jsonOTP.Token) {
+	if !SetTokenValidation(jsonOTP.Username, jsonOTP.Token, c.ClientIP(), c.Request.UserAgent()) {
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    400,
 			Message: "token validation set error",
@@ -177,14 +215,7 @@ func OTPVerify(c *gin.Context) {
 	}
 
 	// set 2FA to enabled
-	f, _ := os.OpenFile(configuration.Config.SecretsDir+"/"+jsonOTP.Username+"/status", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	defer f.Close()
-
-	// write file with 2fa status
-	_, err = f.WriteString("1")
-
-	// check error
-	if err != nil {
+	if err := SetUserStatus(jsonOTP.Username, "1"); err != nil {
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    400,
 			Message: "status set error",
@@ -278,9 +309,20 @@ func Del2FAStatus(c *gin.Context) {
 	// get claims from token
 	claims := jwt.ExtractClaims(c)
 
-	// revocate secret
-	errRevocate := os.Remove(configuration.Config.SecretsDir + "/" + claims["id"].(string) + "/secret")
-	if errRevocate != nil {
+	// get secrets directory of the user
+	dir, err := UserSecretsDir(claims["id"].(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "error in revocate 2FA for user",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// revocate secret, it is missing when only webauthn is enrolled
+	errRevocate := os.Remove(dir + "/secret")
+	if errRevocate != nil && !os.IsNotExist(errRevocate) {
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    403,
 			Message: "error in revocate 2FA for user",
@@ -290,7 +332,7 @@ func Del2FAStatus(c *gin.Context) {
 	}
 
 	// revocate recovery codes
-	errRevocateCodes := os.Remove(configuration.Config.SecretsDir + "/" + claims["id"].(string) + "/codes")
+	errRevocateCodes := os.Remove(dir + "/codes")
 	if errRevocateCodes != nil {
 		// if the file does not exist, it is ok, skip the error
 		if !os.IsNotExist(errRevocateCodes) {
@@ -303,15 +345,19 @@ func Del2FAStatus(c *gin.Context) {
 		}
 	}
 
-	// set 2FA to disabled
-	f, _ := os.OpenFile(configuration.Config.SecretsDir+"/"+claims["id"].(string)+"/status", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	defer f.Close()
-
-	// write file with tokens
-	_, err := f.WriteString("0")
+	// revocate webauthn credentials
+	errRevocateWebAuthn := os.Remove(dir + "/webauthn.json")
+	if errRevocateWebAuthn != nil && !os.IsNotExist(errRevocateWebAuthn) {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    403,
+			Message: "error in delete 2FA webauthn credentials",
+			Data:    nil,
+		}))
+		return
+	}
 
-	// check error
-	if err != nil {
+	// set 2FA to disabled
+	if err := SetUserStatus(claims["id"].(string), "0"); err != nil {
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    400,
 			Message: "2FA not revocated",
@@ -329,15 +375,24 @@ func Del2FAStatus(c *gin.Context) {
 }
 
 func GetUserStatus(username string) (string, error) {
-	status, err := os.ReadFile(configuration.Config.SecretsDir + "/" + username + "/status")
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return "", err
+	}
+	status, err := os.ReadFile(dir + "/status")
 	statusS := strings.TrimSpace(string(status[:]))
 
 	return statusS, err
 }
 
 func GetUserSecret(username string) string {
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return ""
+	}
+
 	// get secret
-	secret, err := os.ReadFile(configuration.Config.SecretsDir + "/" + username + "/secret")
+	secret, err := os.ReadFile(dir + "/secret")
 
 	// handle error
 	if err != nil {
@@ -349,18 +404,23 @@ func GetUserSecret(username string) string {
 }
 
 func SetUserSecret(username string, secret string) (bool, string) {
+	dir, errU := UserSecretsDir(username)
+	if errU != nil {
+		return false, ""
+	}
+
 	// get secret
-	secretB, _ := os.ReadFile(configuration.Config.SecretsDir + "/" + username + "/secret")
+	secretB, _ := os.ReadFile(dir + "/secret")
 
 	// check error
 	if len(string(secretB[:])) == 0 {
 		// check if dir exists, otherwise create it
-		if _, errD := os.Stat(configuration.Config.SecretsDir + "/" + username); os.IsNotExist(errD) {
-			_ = os.MkdirAll(configuration.Config.SecretsDir+"/"+username, 0700)
+		if _, errD := os.Stat(dir); os.IsNotExist(errD) {
+			_ = os.MkdirAll(dir, 0700)
 		}
 
 		// open file
-		f, _ := os.OpenFile(configuration.Config.SecretsDir+"/"+username+"/secret", os.O_WRONLY|os.O_CREATE, 0600)
+		f, _ := os.OpenFile(dir+"/secret", os.O_WRONLY|os.O_CREATE, 0600)
 		defer f.Close()
 
 		// write file with secret
@@ -377,64 +437,111 @@ func SetUserSecret(username string, secret string) (bool, string) {
 	return true, string(secretB[:])
 }
 
+// TokenID returns the id used to track the token inside the token store, it is the `jti` claim
+// or, for tokens issued before it was introduced, the SHA-256 hash of the token
+func TokenID(claims map[string]interface{}, token string) string {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return jti
+	}
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// parseUnverifiedClaims reads the claims of a token without validating it, callers must
+// validate the token first
+func parseUnverifiedClaims(token string) (jwtl.MapClaims, error) {
+	claims := jwtl.MapClaims{}
+	_, _, err := new(jwtl.Parser).ParseUnverified(token, claims)
+	return claims, err
+}
+
 func CheckTokenValidation(username string, token string) bool {
-	// read whole file
-	secrestListB, err := os.ReadFile(configuration.Config.TokensDir + "/" + username)
+	// get token id
+	claims, err := parseUnverifiedClaims(token)
 	if err != nil {
 		return false
 	}
-	secrestList := string(secrestListB)
 
-	// check whether secret list contains token
-	return strings.Contains(secrestList, token)
+	// check whether token store contains token
+	record, found, err := store.Tokens.Get(TokenID(claims, token))
+	if err != nil {
+		logs.Logs.Println("[ERR][JWT] Failed to read token store. Error: " + err.Error())
+		return false
+	}
+	return found && record.Username == username && time.Now().Before(record.ExpiresAt)
 }
 
-func SetTokenValidation(username string, token string) bool {
-	// open file
-	f, _ := os.OpenFile(configuration.Config.TokensDir+"/"+username, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-	defer f.Close()
+func SetTokenValidation(username string, token string, clientIP string, userAgent string) bool {
+	// get token id and times
+	claims, err := parseUnverifiedClaims(token)
+	if err != nil {
+		return false
+	}
+	exp, _ := claims["exp"].(float64)
+	iat, _ := claims["orig_iat"].(float64)
+	record := models.TokenRecord{
+		ID:        TokenID(claims, token),
+		Username:  username,
+		IssuedAt:  time.Unix(int64(iat), 0),
+		ExpiresAt: time.Unix(int64(exp), 0),
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+	}
+	if sudo, ok := claims["sudo"].(float64); ok {
+		record.SudoAt = time.Unix(int64(sudo), 0)
+	}
 
-	// write file with tokens
-	_, err := f.WriteString(token + "\n")
+	// refreshed tokens keep the id, extend the existing record
+	previous, found, err := store.Tokens.Get(record.ID)
+	if err != nil {
+		logs.Logs.Println("[ERR][JWT] Failed to read token store. Error: " + err.Error())
+		return false
+	}
+	if found && previous.Username == username {
+		record.IssuedAt = previous.IssuedAt
+		if previous.ExpiresAt.After(record.ExpiresAt) {
+			record.ExpiresAt = previous.ExpiresAt
+		}
+		if previous.SudoAt.After(record.SudoAt) {
+			record.SudoAt = previous.SudoAt
+		}
+		if record.ClientIP == "" {
+			record.ClientIP = previous.ClientIP
+			record.UserAgent = previous.UserAgent
+		}
+	}
 
-	// check error
-	return err == nil
+	// write token record
+	if err := store.Tokens.Set(record); err != nil {
+		logs.Logs.Println("[ERR][JWT] Failed to write token store. Error: " + err.Error())
+		return false
+	}
+	return true
 }
 
 func DelTokenValidation(username string, token string) bool {
-	// read whole file
-	secrestListB, errR := ioutil.ReadFile(configuration.Config.TokensDir + "/" + username)
-	if errR != nil {
+	// get token id
+	claims, err := parseUnverifiedClaims(token)
+	if err != nil {
 		return false
 	}
-	secrestList := string(secrestListB)
+	id := TokenID(claims, token)
 
 	// match token to remove
-	res := strings.Replace(secrestList, token, "", 1)
-
-	// open file
-	f, _ := os.OpenFile(configuration.Config.TokensDir+"/"+username, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	defer f.Close()
-
-	// write file with tokens
-	_, err := f.WriteString(strings.TrimSpace(res) + "\n")
+	record, found, err := store.Tokens.Get(id)
+	if err != nil || !found || record.Username != username {
+		return false
+	}
 
-	// check error
-	return err == nil
+	// remove token record
+	return store.Tokens.Delete(id) == nil
 }
 
 func ValidateAuth(tokenString string, ensureTokenExists bool) bool {
 	// convert token string and validate it
 	if tokenString != "" {
-		token, err := jwtl.Parse(tokenString, func(token *jwtl.Token) (interface{}, error) {
-			// validate the alg
-			if _, ok := token.Method.(*jwtl.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			// return secret
-			return []byte(configuration.Config.SecretJWT), nil
-		})
+		// verify with the signing key of the token
+		token, err := jwtl.Parse(tokenString, keyring.KeyFunc)
 
 		if err != nil {
 			logs.Logs.Println("[ERR][JWT] error in JWT token validation: " + err.Error())
@@ -465,8 +572,13 @@ func GetRecoveryCodes(username string) []string {
 	// create empty array
 	var recoveryCodes []string
 
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return recoveryCodes
+	}
+
 	// check if recovery codes exists
-	codesB, _ := os.ReadFile(configuration.Config.SecretsDir + "/" + username + "/codes")
+	codesB, _ := os.ReadFile(dir + "/codes")
 
 	// check length
 	if len(string(codesB[:])) == 0 {
@@ -477,7 +589,7 @@ func GetRecoveryCodes(username string) []string {
 		// get recovery codes
 		if len(string(secret)) > 0 {
 			// execute oathtool to get recovery codes
-			out, err := exec.Command("/usr/bin/oathtool", "-w", "4", "-b", secret).Output()
+			out, err := executor.Default.Run(context.Background(), "/usr/bin/oathtool", []string{"-w", "4", "-b", secret}, nil)
 
 			// check errors
 			if err != nil {
@@ -485,7 +597,7 @@ func GetRecoveryCodes(username string) []string {
 			}
 
 			// open file
-			f, _ := os.OpenFile(configuration.Config.SecretsDir+"/"+username+"/codes", os.O_WRONLY|os.O_CREATE, 0600)
+			f, _ := os.OpenFile(dir+"/codes", os.O_WRONLY|os.O_CREATE, 0600)
 			defer f.Close()
 
 			// write file with secret
@@ -510,77 +622,103 @@ func GetRecoveryCodes(username string) []string {
 }
 
 func UpdateRecoveryCodes(username string, codes []string) bool {
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return false
+	}
+
 	// open file
-	f, _ := os.OpenFile(configuration.Config.SecretsDir+"/"+username+"/codes", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	f, _ := os.OpenFile(dir+"/codes", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	defer f.Close()
 
 	// write file with secret
 	codes = append(codes, "")
-	_, err := f.WriteString(strings.Join(codes[:], "\n"))
+	_, err = f.WriteString(strings.Join(codes[:], "\n"))
 
 	// check error
 	return err == nil
 }
 
 func DeleteExpiredTokens() {
-	// create new tokens list
-	var validTokens []string
+	// remove expired records using the expiry index
+	deleted, err := store.Tokens.DeleteExpired(time.Now())
+	if err != nil {
+		logs.Logs.Println("[ERR][JWT] Failed to delete expired tokens. Error: " + err.Error())
+		return
+	}
+	logs.Logs.Println("[INFO][JWT] deleted " + strconv.Itoa(deleted) + " expired tokens")
+}
 
-	// read tokens directory
-	usernames, err := ioutil.ReadDir(configuration.Config.TokensDir)
+// tokenFilesMigrated is created inside TOKENS_DIR once the token files have been migrated
+const tokenFilesMigrated = ".migrated"
+
+// MigrateTokenFiles moves the valid tokens of the per-user files inside TOKENS_DIR, used before
+// the token store was introduced, to the token store and removes the files. It runs once, files
+// not containing only tokens are left untouched
+func MigrateTokenFiles() {
+	marker := filepath.Join(configuration.Config.TokensDir, tokenFilesMigrated)
+	if _, err := os.Stat(marker); err == nil {
+		return
+	}
 
-	// check read error
+	// read tokens directory
+	entries, err := os.ReadDir(configuration.Config.TokensDir)
 	if err != nil {
 		logs.Logs.Println("[ERR][JWT] Failed to read tokens dir " + configuration.Config.TokensDir + ". Error: " + err.Error())
+		return
 	}
 
 	// list usernames
-	for _, username := range usernames {
-		// read whole file
-		tokenstListB, err := ioutil.ReadFile(configuration.Config.TokensDir + "/" + username.Name())
+	for _, entry := range entries {
+		fileName := filepath.Join(configuration.Config.TokensDir, entry.Name())
+		if !entry.Type().IsRegular() || fileName == filepath.Clean(configuration.Config.TokensDB) || fileName == marker {
+			continue
+		}
 
-		// check error
+		// read whole file
+		tokensListB, err := os.ReadFile(fileName)
 		if err != nil {
-			logs.Logs.Println("[ERR][JWT] Failed to read tokens file " + configuration.Config.TokensDir + "/" + username.Name() + ". Error: " + err.Error())
+			logs.Logs.Println("[ERR][JWT] Failed to read tokens file " + fileName + ". Error: " + err.Error())
+			continue
 		}
 
-		// get string file
-		tokensList := string(tokenstListB)
-
-		// convert to array
-		tokens := strings.Split(tokensList, "\n")
-
-		// remove empty elem
-		if tokens[len(tokens)-1] == "" {
-			tokens = tokens[:len(tokens)-1]
+		// every line must be a token, expired ones included
+		tokens := []string{}
+		for _, token := range strings.Split(string(tokensListB), "\n") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
 		}
-
-		// loop all tokens
+		isTokenFile := len(tokens) > 0
 		for _, token := range tokens {
-			// validate token
-			valid := ValidateAuth(token, false)
-
-			// add only valid tokens
-			if valid {
-				token = strings.TrimSpace(token)
-				validTokens = append(validTokens, token)
+			if _, err := parseUnverifiedClaims(token); err != nil {
+				isTokenFile = false
+				break
 			}
 		}
+		if !isTokenFile {
+			logs.Logs.Println("[WARNING][JWT] Skipped file " + fileName + ", it is not a tokens file")
+			continue
+		}
 
-		// rewrite file with only valid tokens
-		f, _ := os.OpenFile(configuration.Config.TokensDir+"/"+username.Name(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-		defer f.Close()
-
-		// compose string
-		writeTokens := strings.Join(validTokens[:], "\n")
-
-		// write file with tokens
-		_, errWrite := f.WriteString(writeTokens + "\n")
+		// add only valid tokens
+		migrated := 0
+		for _, token := range tokens {
+			if ValidateAuth(token, false) && SetTokenValidation(entry.Name(), token, "", "") {
+				migrated++
+			}
+		}
 
-		// check error
-		if errWrite != nil {
-			logs.Logs.Println("[ERR][JWT] Failed to write new tokens file " + configuration.Config.TokensDir + "/" + username.Name() + ". Error: " + errWrite.Error())
+		// remove migrated file
+		if err := os.Remove(fileName); err != nil {
+			logs.Logs.Println("[ERR][JWT] Failed to remove tokens file " + fileName + ". Error: " + err.Error())
+			continue
 		}
+		logs.Logs.Println("[INFO][JWT] migrated " + strconv.Itoa(migrated) + " tokens of user " + entry.Name() + " to token store")
 	}
 
+	// never run again
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		logs.Logs.Println("[ERR][JWT] Failed to write token migration marker " + marker + ". Error: " + err.Error())
+	}
 }
@@ -0,0 +1,173 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/authenticator"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+func TestCheckAuthentication(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		invalid bool
+		ok      bool
+	}{
+		{name: "success", ok: true},
+		{name: "wrong password", err: &ubus.StatusError{Code: ubus.StatusPermissionDenied}, invalid: true},
+		{name: "rpcd error", err: &ubus.StatusError{Code: ubus.StatusUnknownError}},
+		{name: "ubus exit code", err: &executor.ExitError{Code: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFake(t)
+			fake.OnCall("session", "login", `{"ubus_rpc_session": "0123"}`, tt.err)
+
+			identity, err := CheckAuthentication("root", "Nethesis,1234")
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if identity.Username != "root" || identity.Backend != authenticator.BackendLocal {
+					t.Errorf("identity = %+v, want local user root", identity)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := fmt.Sprint(err); tt.invalid != (got == "local: "+authenticator.ErrInvalidCredentials.Error()) {
+				t.Errorf("error = %q, invalid credentials expected %v", got, tt.invalid)
+			}
+		})
+	}
+
+	// login call receives the credentials
+	fake := useFake(t)
+	fake.OnCall("session", "login", `{}`, nil)
+	CheckAuthentication("root", "Nethesis,1234")
+	requests := fake.Requests()
+	if len(requests) != 1 || requests[0].Path != "session" || requests[0].Method != "login" {
+		t.Errorf("requests = %+v, want one session login call", requests)
+	}
+
+	// empty credentials never reach the backend
+	fake = useFake(t)
+	if _, err := CheckAuthentication("root", ""); !errors.Is(err, authenticator.ErrInvalidCredentials) {
+		t.Errorf("error = %v, want invalid credentials", err)
+	}
+	if len(fake.Requests()) != 0 {
+		t.Errorf("backend called with empty password")
+	}
+}
+
+func TestGetRecoveryCodes(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	oathtool := []string{"-w", "4", "-b", secret}
+
+	tests := []struct {
+		name   string
+		user   string
+		codes  string
+		script func(fake *executor.Fake)
+		want   []string
+		saved  string
+	}{
+		{
+			name: "generated",
+			user: "generated",
+			script: func(fake *executor.Fake) {
+				fake.OnCommand("/usr/bin/oathtool", oathtool, "111111\n222222\n", 0)
+			},
+			want:  []string{"111111", "222222"},
+			saved: "111111\n222222\n",
+		},
+		{
+			name:  "saved",
+			user:  "saved",
+			codes: "333333\n444444\n",
+			script: func(fake *executor.Fake) {
+				fake.OnCommand("/usr/bin/oathtool", oathtool, "555555\n", 0)
+			},
+			want:  []string{"333333", "444444"},
+			saved: "333333\n444444\n",
+		},
+		{
+			name: "oathtool error",
+			user: "failed",
+			script: func(fake *executor.Fake) {
+				fake.OnCommand("/usr/bin/oathtool", oathtool, "oathtool: base32 decoding failed", 1)
+			},
+			want: []string{},
+		},
+		{
+			name:   "oathtool missing",
+			user:   "missing",
+			script: func(fake *executor.Fake) {},
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFake(t)
+			tt.script(fake)
+
+			dir := filepath.Join(configuration.Config.SecretsDir, tt.user)
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "secret"), []byte(secret), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.codes != "" {
+				if err := os.WriteFile(filepath.Join(dir, "codes"), []byte(tt.codes), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/2fa/recovery-codes", nil)
+			c.Set("JWT_PAYLOAD", jwt.MapClaims{"id": tt.user})
+			Get2FARecoveryCodes(c)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", recorder.Code)
+			}
+			got := []string{}
+			if list, ok := decodeBody(t, recorder)["codes"].([]interface{}); ok {
+				for _, code := range list {
+					got = append(got, code.(string))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("codes = %v, want %v", got, tt.want)
+			}
+
+			saved, _ := os.ReadFile(filepath.Join(dir, "codes"))
+			if string(saved) != tt.saved {
+				t.Errorf("codes file = %q, want %q", saved, tt.saved)
+			}
+		})
+	}
+}
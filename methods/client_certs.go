@@ -0,0 +1,211 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// ClientCertProvider is set in the provider claim of requests authenticated by a client certificate
+const ClientCertProvider = "mtls"
+
+var clientCerts = []models.ClientCert{}
+var clientCRL *x509.RevocationList
+var clientCertsLock sync.RWMutex
+
+// readPEMOrDER returns the DER blocks of a PEM file, or the whole content of a DER file
+func readPEMOrDER(path string, blockType string) ([][]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := [][]byte{}
+	rest := content
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == blockType {
+			blocks = append(blocks, block.Bytes)
+		}
+	}
+	if len(blocks) == 0 {
+		blocks = append(blocks, content)
+	}
+	return blocks, nil
+}
+
+// clientCACertificates reads the certificates of TLS_CLIENT_CA_FILE
+func clientCACertificates() ([]*x509.Certificate, error) {
+	blocks, err := readPEMOrDER(configuration.Config.TLSClientCAFile, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := []*x509.Certificate{}
+	for _, block := range blocks {
+		certificate, err := x509.ParseCertificate(block)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// ClientCAPool returns the pool used by the TLS listener to verify client certificates
+func ClientCAPool() (*x509.CertPool, error) {
+	certificates, err := clientCACertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, certificate := range certificates {
+		pool.AddCert(certificate)
+	}
+	return pool, nil
+}
+
+// LoadClientCerts reads the client certificates mapping and the revocation list, signed by one of
+// the client CAs. A missing mapping file means no client is allowed
+func LoadClientCerts() error {
+	mapping := []models.ClientCert{}
+	content, err := os.ReadFile(configuration.Config.ClientCertsFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &mapping); err != nil {
+			return err
+		}
+	}
+	for _, entry := range mapping {
+		if (entry.Subject == "" && entry.SAN == "") || (entry.User == "") == (entry.APIKey == "") {
+			return errors.New("client certificate entries need subject or san, and one of user or api_key")
+		}
+	}
+
+	var crl *x509.RevocationList
+	if configuration.Config.TLSClientCRLFile != "" {
+		blocks, err := readPEMOrDER(configuration.Config.TLSClientCRLFile, "X509 CRL")
+		if err != nil {
+			return err
+		}
+		if crl, err = x509.ParseRevocationList(blocks[0]); err != nil {
+			return err
+		}
+
+		// check the list is issued by a client CA
+		certificates, err := clientCACertificates()
+		if err != nil {
+			return err
+		}
+		signed := false
+		for _, certificate := range certificates {
+			if crl.CheckSignatureFrom(certificate) == nil {
+				signed = true
+				break
+			}
+		}
+		if !signed {
+			return errors.New("revocation list not signed by a client CA")
+		}
+	}
+
+	clientCertsLock.Lock()
+	clientCerts = mapping
+	clientCRL = crl
+	clientCertsLock.Unlock()
+	return nil
+}
+
+// matchClientCert tells if the certificate has the subject and the SAN of the entry, when set
+func matchClientCert(entry models.ClientCert, certificate *x509.Certificate) bool {
+	if entry.Subject != "" && entry.Subject != certificate.Subject.String() {
+		return false
+	}
+	if entry.SAN == "" {
+		return true
+	}
+
+	sans := append([]string{}, certificate.DNSNames...)
+	sans = append(sans, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range certificate.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, san := range sans {
+		if san == entry.SAN {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckClientCert checks the revocation of a certificate verified by the TLS listener and returns the
+// claims of the mapped user or API key, or an error message when the certificate is not accepted
+func CheckClientCert(certificate *x509.Certificate, clientIP string) (jwt.MapClaims, string) {
+	clientCertsLock.RLock()
+	crl := clientCRL
+	mapping := clientCerts
+	clientCertsLock.RUnlock()
+
+	// check revocation, an outdated list is refused to not miss recent revocations
+	if crl != nil && bytes.Equal(crl.RawIssuer, certificate.RawIssuer) {
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			return nil, "client certificate revocation list expired"
+		}
+		for _, revoked := range crl.RevokedCertificateEntries {
+			if revoked.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+				return nil, "client certificate revoked"
+			}
+		}
+	}
+
+	for _, entry := range mapping {
+		if !matchClientCert(entry, certificate) {
+			continue
+		}
+
+		// use scope of the API key
+		if entry.APIKey != "" {
+			apiKey, message := CheckAPIKeyID(entry.APIKey, clientIP)
+			if message != "" {
+				return nil, message
+			}
+			claims := APIKeyClaims(apiKey)
+			claims["provider"] = ClientCertProvider
+			return claims, ""
+		}
+
+		// use role of the user
+		return jwt.MapClaims{
+			"id":       entry.User,
+			"role":     configuration.GetUserRole(entry.User),
+			"provider": ClientCertProvider,
+			"2fa":      false,
+		}, ""
+	}
+	return nil, "client certificate not mapped"
+}
@@ -11,10 +11,13 @@ package methods
 
 import (
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 
+	"github.com/NethServer/nethsecurity-api/audit"
 	"github.com/NethServer/nethsecurity-api/configuration"
 	"github.com/NethServer/nethsecurity-api/response"
 	"github.com/fatih/structs"
@@ -47,9 +50,10 @@ func UploadFile(c *gin.Context) {
 
 	// set name with uuid to avoid overrides
 	name := "upload-" + uuid.New().String()
+	audit.SetTarget(c, name)
 
 	// upload the file to specific directory and check error
-	if err := c.SaveUploadedFile(file, configuration.Config.UploadFilePath+"/"+name); err != nil {
+	if err := saveUploadedFile(file, configuration.Config.UploadFilePath+"/"+name); err != nil {
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    400,
 			Message: "file upload error. error on save",
@@ -66,6 +70,40 @@ func UploadFile(c *gin.Context) {
 	}))
 }
 
+// saveUploadedFile writes the file to a temporary name and renames it when complete, so an upload
+// interrupted by a shutdown never leaves a partial file under the final name
+func saveUploadedFile(file *multipart.FileHeader, path string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	// same permissions of files created by os.Create
+	if err := dst.Chmod(0644); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), path)
+}
+
 func DownloadFile(c *gin.Context) {
 	// get filename
 	fileName := c.Param("filename")
@@ -0,0 +1,290 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/ubus"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+type job struct {
+	models.Job
+	cancel context.CancelFunc
+}
+
+var jobs = map[string]*job{}
+var jobsLock sync.Mutex
+var jobsRunning sync.WaitGroup
+
+// CreateJob starts a ubus call in background and returns the id of the job
+func CreateJob(c *gin.Context) {
+	// parse request fields
+	var jsonUBusCall models.UBusCallJSON
+	if err := c.ShouldBindBodyWith(&jsonUBusCall, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// check if path and method are allowed by the policy
+	if !configuration.UBusAllowed(jsonUBusCall.Path, jsonUBusCall.Method) {
+		c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusBadRequest{
+			Code:    403,
+			Message: "ubus call action forbidden",
+			Data:    "method not allowed",
+		}))
+		return
+	}
+
+	// create job owned by current user
+	claims := jwt.ExtractClaims(c)
+	owner := claims["id"].(string)
+
+	// check running jobs limits
+	jobsLock.Lock()
+	running, runningOwner := 0, 0
+	for _, j := range jobs {
+		if j.State == models.JobRunning {
+			running++
+			if j.Owner == owner {
+				runningOwner++
+			}
+		}
+	}
+	if running >= configuration.Config.JobsMaxRunning || runningOwner >= configuration.Config.JobsMaxRunningUser {
+		jobsLock.Unlock()
+		logs.Logs.Println("[INFO][JOBS] job refused for user " + owner + ": too many running jobs")
+		c.JSON(http.StatusTooManyRequests, structs.Map(response.StatusTooManyRequests{
+			Code:    429,
+			Message: "too many running jobs",
+			Data:    "max running jobs: " + strconv.Itoa(configuration.Config.JobsMaxRunning) + ", per user: " + strconv.Itoa(configuration.Config.JobsMaxRunningUser),
+		}))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job: models.Job{
+			ID:        uuid.New().String(),
+			Owner:     owner,
+			Path:      jsonUBusCall.Path,
+			Method:    jsonUBusCall.Method,
+			State:     models.JobRunning,
+			CreatedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	jobs[j.ID] = j
+	jobsLock.Unlock()
+
+	logs.Logs.Println("[INFO][JOBS] job " + j.ID + " started by user " + j.Owner + ". " + j.Path + " " + j.Method)
+
+	// run call in background
+	jobsRunning.Add(1)
+	go runJob(ctx, j, jsonUBusCall)
+
+	// return 201 with job id
+	c.JSON(http.StatusCreated, structs.Map(response.StatusCreated{
+		Code:    201,
+		Message: "job created",
+		Data:    gin.H{"id": j.ID},
+	}))
+}
+
+func runJob(ctx context.Context, j *job, jsonUBusCall models.UBusCallJSON) {
+	defer jobsRunning.Done()
+
+	out, err := RunUBusCall(ctx, jsonUBusCall)
+	code, result := UBusCallResult(out, err)
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	now := time.Now()
+	j.FinishedAt = &now
+	j.Output = result
+	j.ExitCode = jobExitCode(err)
+	j.cancel()
+
+	switch {
+	case ctx.Err() != nil:
+		j.State = models.JobCancelled
+	case code == http.StatusOK:
+		j.State = models.JobSucceeded
+	default:
+		j.State = models.JobFailed
+	}
+
+	logs.Logs.Println("[INFO][JOBS] job " + j.ID + " of user " + j.Owner + " " + j.State)
+}
+
+// jobExitCode returns the exit code of ns.* scripts or the ubus status of other calls
+func jobExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *executor.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	var statusErr *ubus.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return -1
+}
+
+// getOwnedJob returns a copy of the job, only if it is owned by the current user
+func getOwnedJob(c *gin.Context) (models.Job, bool) {
+	claims := jwt.ExtractClaims(c)
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	j, ok := jobs[c.Param("id")]
+	if !ok || j.Owner != claims["id"].(string) {
+		return models.Job{}, false
+	}
+	return j.Job, true
+}
+
+// ListJobs returns the jobs of the current user
+func ListJobs(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+
+	jobsLock.Lock()
+	list := []models.Job{}
+	for _, j := range jobs {
+		if j.Owner == claims["id"].(string) {
+			list = append(list, j.Job)
+		}
+	}
+	jobsLock.Unlock()
+
+	// newest jobs first
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].CreatedAt.After(list[k].CreatedAt)
+	})
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "jobs list",
+		Data:    list,
+	}))
+}
+
+// GetJob returns state, exit code and output of a job
+func GetJob(c *gin.Context) {
+	j, ok := getOwnedJob(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "job not found",
+			Data:    nil,
+		}))
+		return
+	}
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "job status",
+		Data:    j,
+	}))
+}
+
+// DeleteJob cancels a running job, or removes a finished one
+func DeleteJob(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+
+	jobsLock.Lock()
+	j, ok := jobs[c.Param("id")]
+	if !ok || j.Owner != claims["id"].(string) {
+		jobsLock.Unlock()
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "job not found",
+			Data:    nil,
+		}))
+		return
+	}
+
+	// running jobs are kept to report the cancellation
+	message := "job deleted"
+	if j.State == models.JobRunning {
+		j.cancel()
+		message = "job cancelled"
+	} else {
+		delete(jobs, j.ID)
+	}
+	jobsLock.Unlock()
+
+	logs.Logs.Println("[INFO][JOBS] " + message + " by user " + j.Owner + ": " + j.ID)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: message,
+		Data:    nil,
+	}))
+}
+
+// DeleteExpiredJobs removes the jobs finished more than JOBS_RETENTION seconds ago
+func DeleteExpiredJobs() {
+	limit := time.Now().Add(-time.Duration(configuration.Config.JobsRetention) * time.Second)
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	for id, j := range jobs {
+		if j.FinishedAt != nil && j.FinishedAt.Before(limit) {
+			delete(jobs, id)
+		}
+	}
+}
+
+// CancelJobs cancels the running jobs, killing their child processes, and waits for them to end
+// until ctx is done
+func CancelJobs(ctx context.Context) error {
+	jobsLock.Lock()
+	for _, j := range jobs {
+		if j.State == models.JobRunning {
+			j.cancel()
+		}
+	}
+	jobsLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		jobsRunning.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
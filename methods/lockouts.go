@@ -0,0 +1,184 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+)
+
+// failure counters of password and OTP checks, by username and by client IP
+var userLockouts = map[string]*models.Lockout{}
+var ipLockouts = map[string]*models.Lockout{}
+var lockoutsLock sync.Mutex
+
+// registerFailure increments the counter and locks it once the threshold is reached, doubling
+// the lock duration at every further failure
+func registerFailure(lockout *models.Lockout, threshold int, now time.Time) {
+	maxLock := time.Duration(configuration.Config.LockoutMax) * time.Second
+
+	// forget failures older than the longest lock
+	if now.Sub(lockout.LastFailure) > maxLock {
+		lockout.Failures = 0
+	}
+	lockout.Failures++
+	lockout.LastFailure = now
+
+	if lockout.Failures >= threshold {
+		exponent := math.Min(float64(lockout.Failures-threshold), 30)
+		duration := time.Duration(float64(configuration.Config.LockoutBase)*math.Pow(2, exponent)) * time.Second
+		if duration > maxLock {
+			duration = maxLock
+		}
+		lockout.LockedUntil = now.Add(duration)
+	}
+}
+
+// RegisterAuthFailure records a failed password or OTP check of the user from the client IP
+func RegisterAuthFailure(username string, ip string) {
+	lockoutsLock.Lock()
+	defer lockoutsLock.Unlock()
+
+	now := time.Now()
+	if username != "" {
+		if userLockouts[username] == nil {
+			userLockouts[username] = &models.Lockout{Username: username}
+		}
+		registerFailure(userLockouts[username], configuration.Config.LockoutMaxFailures, now)
+		if userLockouts[username].LockedUntil.After(now) {
+			logs.Logs.Println("[WARNING][AUTH] user " + username + " locked until " + userLockouts[username].LockedUntil.Format(time.RFC3339))
+		}
+	}
+	if ipLockouts[ip] == nil {
+		ipLockouts[ip] = &models.Lockout{IP: ip}
+	}
+	registerFailure(ipLockouts[ip], configuration.Config.LockoutMaxFailuresIP, now)
+	if ipLockouts[ip].LockedUntil.After(now) {
+		logs.Logs.Println("[WARNING][AUTH] client " + ip + " locked until " + ipLockouts[ip].LockedUntil.Format(time.RFC3339))
+	}
+}
+
+// RegisterAuthSuccess resets the failures of the user, failures of the client IP expire by themselves
+func RegisterAuthSuccess(username string) {
+	lockoutsLock.Lock()
+	defer lockoutsLock.Unlock()
+
+	delete(userLockouts, username)
+}
+
+// GetAuthLockout returns how long the user or the client IP are still locked, zero if they are not
+func GetAuthLockout(username string, ip string) time.Duration {
+	lockoutsLock.Lock()
+	defer lockoutsLock.Unlock()
+
+	var wait time.Duration
+	now := time.Now()
+	if lockout, ok := userLockouts[username]; ok && lockout.LockedUntil.Sub(now) > wait {
+		wait = lockout.LockedUntil.Sub(now)
+	}
+	if lockout, ok := ipLockouts[ip]; ok && lockout.LockedUntil.Sub(now) > wait {
+		wait = lockout.LockedUntil.Sub(now)
+	}
+	return wait
+}
+
+// CheckAuthLockout aborts the request with 429 if the user or the client IP are locked
+func CheckAuthLockout(c *gin.Context, username string) bool {
+	wait := GetAuthLockout(username, c.ClientIP())
+	if wait <= 0 {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	logs.Logs.Println("[INFO][AUTH] request refused for locked user " + username + " from " + c.ClientIP())
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, structs.Map(response.StatusTooManyRequests{
+		Code:    429,
+		Message: "too many failed attempts",
+		Data:    gin.H{"retry_after": retryAfter},
+	}))
+	return false
+}
+
+// ListLockouts returns the users and client IPs with failed attempts
+func ListLockouts(c *gin.Context) {
+	lockoutsLock.Lock()
+	users := []models.Lockout{}
+	for _, lockout := range userLockouts {
+		users = append(users, *lockout)
+	}
+	ips := []models.Lockout{}
+	for _, lockout := range ipLockouts {
+		ips = append(ips, *lockout)
+	}
+	lockoutsLock.Unlock()
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "lockouts list",
+		Data:    gin.H{"users": users, "ips": ips},
+	}))
+}
+
+// UnlockUser resets the failures of a user
+func UnlockUser(c *gin.Context) {
+	lockoutsLock.Lock()
+	delete(userLockouts, c.Param("username"))
+	lockoutsLock.Unlock()
+
+	logs.Logs.Println("[INFO][AUTH] user " + c.Param("username") + " unlocked by user " + jwt.ExtractClaims(c)["id"].(string))
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "user unlocked",
+		Data:    nil,
+	}))
+}
+
+// UnlockIP resets the failures of a client IP
+func UnlockIP(c *gin.Context) {
+	lockoutsLock.Lock()
+	delete(ipLockouts, c.Param("ip"))
+	lockoutsLock.Unlock()
+
+	logs.Logs.Println("[INFO][AUTH] client " + c.Param("ip") + " unlocked by user " + jwt.ExtractClaims(c)["id"].(string))
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "client unlocked",
+		Data:    nil,
+	}))
+}
+
+// DeleteExpiredLockouts removes the counters without failures since the longest lock
+func DeleteExpiredLockouts() {
+	limit := time.Now().Add(-time.Duration(configuration.Config.LockoutMax) * time.Second)
+
+	lockoutsLock.Lock()
+	defer lockoutsLock.Unlock()
+
+	for key, lockout := range userLockouts {
+		if lockout.LastFailure.Before(limit) {
+			delete(userLockouts, key)
+		}
+	}
+	for key, lockout := range ipLockouts {
+		if lockout.LastFailure.Before(limit) {
+			delete(ipLockouts, key)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"net/http"
+	"strings"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+)
+
+// GetLogLevel returns the current log level
+func GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "log level",
+		Data:    gin.H{"level": logs.Logs.Level()},
+	}))
+}
+
+// SetLogLevel changes the log level until the next restart
+func SetLogLevel(c *gin.Context) {
+	// parse request fields
+	var jsonLogLevel models.LogLevelJSON
+	if err := c.ShouldBindBodyWith(&jsonLogLevel, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// check level
+	if _, err := logs.ParseLevel(jsonLogLevel.Level); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "invalid log level",
+			Data:    "level must be debug, info, warn or error",
+		}))
+		return
+	}
+
+	// logged before the change, so it is kept when the level is raised to error
+	logs.Logs.Println("[WARNING][LOGS] log level changed from " + logs.Logs.Level() + " to " + strings.ToLower(jsonLogLevel.Level) + " by user " + jwt.ExtractClaims(c)["id"].(string))
+	logs.Logs.SetLevel(jsonLogLevel.Level)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "log level changed",
+		Data:    gin.H{"level": logs.Logs.Level()},
+	}))
+}
@@ -0,0 +1,130 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+)
+
+// CheckPasswordPolicy checks the new password of the user against the strength policy, returning the
+// validation messages of the rules not satisfied
+func CheckPasswordPolicy(username string, oldPassword string, newPassword string) []string {
+	messages := []string{}
+
+	if len([]rune(newPassword)) < configuration.Config.PasswordMinLength {
+		messages = append(messages, "password_too_short")
+	}
+
+	// count character classes: lowercase, uppercase, digits and symbols
+	var lower, upper, digit, symbol int
+	for _, r := range newPassword {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if lower+upper+digit+symbol < configuration.Config.PasswordMinClasses {
+		messages = append(messages, "password_too_weak")
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(newPassword), strings.ToLower(username)) {
+		messages = append(messages, "password_contains_username")
+	}
+	if newPassword == oldPassword {
+		messages = append(messages, "password_unchanged")
+	}
+
+	return messages
+}
+
+// SetPassword changes the system password of the user through rpcd
+func SetPassword(ctx context.Context, username string, password string) error {
+	_, err := executor.Default.Call(ctx, "luci", "setPassword", map[string]string{
+		"username": username,
+		"password": password,
+	})
+	return err
+}
+
+// ExpirePassword forces the user to change password at next login
+func ExpirePassword(username string) error {
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(dir+"/password_expired", []byte("1"), 0600)
+}
+
+// SetPasswordChanged records the time of a password change and removes a forced change
+func SetPasswordChanged(username string) error {
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Remove(dir + "/password_expired"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(dir+"/password_changed", []byte(time.Now().Format(time.RFC3339)), 0600)
+}
+
+// InitPasswordChanged starts the password age of the user at first login, when a maximum age is set
+func InitPasswordChanged(username string) {
+	if configuration.Config.PasswordMaxAge <= 0 {
+		return
+	}
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(dir + "/password_changed"); errors.Is(err, os.ErrNotExist) {
+		_ = SetPasswordChanged(username)
+	}
+}
+
+// PasswordChangeRequired returns true if the password of the user was expired by an admin or is older
+// than the maximum age
+func PasswordChangeRequired(username string) bool {
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(dir + "/password_expired"); err == nil {
+		return true
+	}
+
+	if configuration.Config.PasswordMaxAge > 0 {
+		content, err := os.ReadFile(dir + "/password_changed")
+		if err != nil {
+			return false
+		}
+		changed, err := time.Parse(time.RFC3339, strings.TrimSpace(string(content)))
+		if err != nil {
+			return false
+		}
+		return time.Since(changed) > time.Duration(configuration.Config.PasswordMaxAge)*time.Second
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/utils"
+	jwt "github.com/appleboy/gin-jwt/v2"
+)
+
+// ClaimsActions returns the actions granted to the request. Tokens carry only the role, its actions
+// are read at every request to follow changes of the roles file; API keys carry their own scope
+func ClaimsActions(claims jwt.MapClaims) []string {
+	if _, ok := claims["api_key"]; !ok {
+		role, _ := claims["role"].(string)
+		return configuration.GetRoleActions(role)
+	}
+
+	var actions []string
+	if list, ok := claims["actions"].([]interface{}); ok {
+		for _, action := range list {
+			if s, ok := action.(string); ok {
+				actions = append(actions, s)
+			}
+		}
+	}
+	return actions
+}
+
+// CheckUBusAuthorization checks the role and the sudo rules for a ubus call, returning an
+// error message when the call is not allowed
+func CheckUBusAuthorization(claims jwt.MapClaims, jsonUBusCall models.UBusCallJSON) (bool, string) {
+	if !utils.MatchAction(ClaimsActions(claims), "ubus", jsonUBusCall.Path, jsonUBusCall.Method) {
+		return false, "ubus call forbidden for current role"
+	}
+	if rule, ok := configuration.GetSudoRule(jsonUBusCall.Path, jsonUBusCall.Method); ok {
+		if !CheckSudoClaims(claims, rule.MaxAge, rule.RequireOTP) {
+			if rule.RequireOTP && claims["2fa"] == true {
+				return false, "sudo mode with otp required"
+			}
+			return false, "sudo mode required"
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,25 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+)
+
+// ErrInvalidUsername is returned for usernames that can not be used as a directory name
+var ErrInvalidUsername = errors.New("invalid username")
+
+// UserSecretsDir returns the directory holding the 2FA and password files of the user, refusing
+// names that would resolve outside the secrets directory
+func UserSecretsDir(username string) (string, error) {
+	if username == "" || username == "." || username == ".." || strings.ContainsAny(username, "/\\\x00") {
+		return "", ErrInvalidUsername
+	}
+	return configuration.Config.SecretsDir + "/" + username, nil
+}
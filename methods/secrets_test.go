@@ -0,0 +1,55 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+)
+
+func TestUserSecretsDir(t *testing.T) {
+	tests := []struct {
+		username string
+		valid    bool
+	}{
+		{"root", true},
+		{"ldap:alice", true},
+		{"alice.smith", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../jwt_keys", false},
+		{"alice/../../etc", false},
+		{"alice\\..", false},
+		{"alice\x00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			dir, err := UserSecretsDir(tt.username)
+			if tt.valid {
+				if err != nil || dir != configuration.Config.SecretsDir+"/"+tt.username {
+					t.Fatalf("got %q, %v", dir, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidUsername) {
+				t.Fatalf("got %q, %v, want ErrInvalidUsername", dir, err)
+			}
+		})
+	}
+}
+
+func TestExpirePasswordInvalidUsername(t *testing.T) {
+	if err := ExpirePassword("../jwt_keys"); !errors.Is(err, ErrInvalidUsername) {
+		t.Fatalf("got %v, want ErrInvalidUsername", err)
+	}
+	if _, err := os.Stat(configuration.Config.SecretsDir + "/../jwt_keys/password_expired"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file written outside the secrets directory: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/store"
+	"github.com/NethServer/nethsecurity-api/utils"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+)
+
+// currentTokenID returns the id of the token used by the request
+func currentTokenID(c *gin.Context) string {
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer"))
+	return TokenID(jwt.ExtractClaims(c), token)
+}
+
+// otherSessionsGranted checks that the role grants the route /api/sessions/users/<username> for the
+// request method, needed to manage the sessions of other users
+func otherSessionsGranted(c *gin.Context, other string) bool {
+	return utils.MatchAction(ClaimsActions(jwt.ExtractClaims(c)), "route", "/api/sessions/users/"+other, c.Request.Method)
+}
+
+// otherSessionsSudo checks the sudo mode needed to revoke sessions of other users, replying when missing
+func otherSessionsSudo(c *gin.Context) bool {
+	if c.Request.Method == http.MethodGet || CheckSudoClaims(jwt.ExtractClaims(c), configuration.Config.SudoMaxAge, false) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+		Code:    403,
+		Message: "sudo mode required",
+		Data:    nil,
+	}))
+	return false
+}
+
+// sessionsUser returns the user whose sessions are managed by the request: the current user or,
+// if allowed, the one passed in the username query parameter
+func sessionsUser(c *gin.Context) (string, bool) {
+	username := jwt.ExtractClaims(c)["id"].(string)
+
+	if other := c.Query("username"); other != "" && other != username {
+		if !otherSessionsGranted(c, other) {
+			c.JSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+				Code:    403,
+				Message: "sessions of other users forbidden for current role",
+				Data:    nil,
+			}))
+			return "", false
+		}
+		return other, otherSessionsSudo(c)
+	}
+	return username, true
+}
+
+// ListSessions returns the active sessions of the user
+func ListSessions(c *gin.Context) {
+	username, ok := sessionsUser(c)
+	if !ok {
+		return
+	}
+
+	records, err := store.Tokens.List(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "sessions read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// compose sessions, skip the expired ones not yet removed
+	now := time.Now()
+	current := currentTokenID(c)
+	sessions := []models.Session{}
+	for _, record := range records {
+		if now.After(record.ExpiresAt) {
+			continue
+		}
+		sessions = append(sessions, models.Session{
+			ID:        record.ID,
+			Username:  record.Username,
+			IssuedAt:  record.IssuedAt,
+			ExpiresAt: record.ExpiresAt,
+			ClientIP:  record.ClientIP,
+			UserAgent: record.UserAgent,
+			Sudo:      now.Unix()-record.SudoAt.Unix() <= configuration.Config.SudoMaxAge,
+			Current:   record.ID == current,
+		})
+	}
+
+	// newest sessions first
+	sort.Slice(sessions, func(i, k int) bool {
+		return sessions[i].IssuedAt.After(sessions[k].IssuedAt)
+	})
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "sessions list",
+		Data:    sessions,
+	}))
+}
+
+// DeleteSession revokes a session of the user
+func DeleteSession(c *gin.Context) {
+	claims := jwt.ExtractClaims(c)
+	username := claims["id"].(string)
+
+	// get session, sessions of other users are hidden unless the role can manage them
+	record, found, err := store.Tokens.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "sessions read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	other := found && record.Username != username
+	if !found || (other && !otherSessionsGranted(c, record.Username)) {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "session not found",
+			Data:    nil,
+		}))
+		return
+	}
+	if other && !otherSessionsSudo(c) {
+		return
+	}
+
+	// remove token record
+	if err := store.Tokens.Delete(record.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "session revoke error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	logs.Logs.Println("[INFO][AUTH] session " + record.ID + " of user " + record.Username + " revoked by user " + username)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "session revoked",
+		Data:    nil,
+	}))
+}
+
+// DeleteSessions revokes every session of the user, including the current one
+func DeleteSessions(c *gin.Context) {
+	username, ok := sessionsUser(c)
+	if !ok {
+		return
+	}
+
+	// remove all token records of the user
+	if err := store.Tokens.DeleteUser(username); err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "sessions revoke error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	logs.Logs.Println("[INFO][AUTH] all sessions of user " + username + " revoked by user " + jwt.ExtractClaims(c)["id"].(string))
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "sessions revoked",
+		Data:    nil,
+	}))
+}
@@ -0,0 +1,33 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+)
+
+// CheckSudoClaims checks if the `sudo` claim is present and less than maxAge seconds ago.
+// When requireOTP is set and the user has 2FA enabled, sudo mode must also be confirmed
+// with an OTP inside the same window, through the `sudo_otp` claim
+func CheckSudoClaims(claims jwt.MapClaims, maxAge int64, requireOTP bool) bool {
+	now := time.Now().Unix()
+
+	sudo, ok := claims["sudo"].(float64)
+	if !ok || now-int64(sudo) > maxAge {
+		return false
+	}
+
+	if requireOTP && claims["2fa"] == true {
+		sudoOTP, ok := claims["sudo_otp"].(float64)
+		if !ok || now-int64(sudoOTP) > maxAge {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,134 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// TwoFactorVerifiedKey is set in the context with the *models.UserAuthorizations of the login once the
+// second factor of a pending login is verified, the session token is then issued by the next handler
+const TwoFactorVerifiedKey = "two_factor_verified"
+
+// twoFactorMaxFailures is the number of wrong codes after which a challenge is dropped
+const twoFactorMaxFailures = 5
+
+// twoFactorChallenge is a login waiting for the second factor, bound to the client that sent the password.
+// Role and provider of external identities are kept for the session token
+type twoFactorChallenge struct {
+	Username  string
+	Role      string
+	Provider  string
+	ClientIP  string
+	UserAgent string
+	ExpiresAt time.Time
+	Failures  int
+}
+
+var twoFactorChallenges = map[string]*twoFactorChallenge{}
+var twoFactorChallengesLock sync.Mutex
+
+// NewTwoFactorChallenge creates the challenge returned by login when 2FA is enabled
+func NewTwoFactorChallenge(user models.UserAuthorizations, clientIP string, userAgent string) (string, time.Time, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+	id := hex.EncodeToString(random)
+	expiresAt := time.Now().Add(time.Duration(configuration.Config.TwoFactorTimeout) * time.Second)
+
+	twoFactorChallengesLock.Lock()
+	defer twoFactorChallengesLock.Unlock()
+
+	// remove expired challenges
+	now := time.Now()
+	for key, challenge := range twoFactorChallenges {
+		if challenge.ExpiresAt.Before(now) {
+			delete(twoFactorChallenges, key)
+		}
+	}
+
+	twoFactorChallenges[id] = &twoFactorChallenge{
+		Username:  user.Username,
+		Role:      user.Role,
+		Provider:  user.Provider,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		ExpiresAt: expiresAt,
+	}
+	return id, expiresAt, nil
+}
+
+// GetTwoFactorChallenge returns the user of a valid challenge sent by the same client that logged in
+func GetTwoFactorChallenge(c *gin.Context, id string) (string, bool) {
+	twoFactorChallengesLock.Lock()
+	defer twoFactorChallengesLock.Unlock()
+
+	challenge, ok := twoFactorChallenges[id]
+	if !ok || challenge.ExpiresAt.Before(time.Now()) {
+		return "", false
+	}
+	if challenge.ClientIP != c.ClientIP() || challenge.UserAgent != c.Request.UserAgent() {
+		logs.Logs.Println("[INFO][2FA] challenge of user " + challenge.Username + " sent by a different client " + c.ClientIP())
+		return "", false
+	}
+	audit.SetUser(c, challenge.Username)
+	return challenge.Username, true
+}
+
+// FailTwoFactorChallenge counts a wrong second factor, dropping the challenge after too many
+func FailTwoFactorChallenge(id string) {
+	twoFactorChallengesLock.Lock()
+	defer twoFactorChallengesLock.Unlock()
+
+	if challenge, ok := twoFactorChallenges[id]; ok {
+		challenge.Failures++
+		if challenge.Failures >= twoFactorMaxFailures {
+			delete(twoFactorChallenges, id)
+		}
+	}
+}
+
+// CompleteTwoFactorChallenge drops a verified challenge and marks the request for token issue, it
+// returns false if the challenge was already used
+func CompleteTwoFactorChallenge(c *gin.Context, id string) bool {
+	twoFactorChallengesLock.Lock()
+	challenge, ok := twoFactorChallenges[id]
+	delete(twoFactorChallenges, id)
+	twoFactorChallengesLock.Unlock()
+
+	if !ok {
+		return false
+	}
+	c.Set(TwoFactorVerifiedKey, &models.UserAuthorizations{
+		Username: challenge.Username,
+		Role:     challenge.Role,
+		Provider: challenge.Provider,
+	})
+	return true
+}
+
+// TwoFactorMethods returns the second factors configured for the user
+func TwoFactorMethods(username string) []string {
+	methods := []string{}
+	if len(GetUserSecret(username)) > 0 {
+		methods = append(methods, "otp")
+	}
+	if data, err := GetWebAuthnCredentials(username); err == nil && len(data.Credentials) > 0 {
+		methods = append(methods, "webauthn")
+	}
+	return methods
+}
@@ -0,0 +1,46 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+func TestTwoFactorChallengeKeepsIdentity(t *testing.T) {
+	login := models.UserAuthorizations{Username: "ldap:alice", Role: "helpdesk", Provider: "ldap"}
+	challenge, _, err := NewTwoFactorChallenge(login, "192.0.2.10", "test-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/2fa/otp-verify", nil)
+	c.Request.RemoteAddr = "192.0.2.10:40000"
+	c.Request.Header.Set("User-Agent", "test-agent")
+
+	if username, ok := GetTwoFactorChallenge(c, challenge); !ok || username != login.Username {
+		t.Fatalf("challenge user = %q, %v", username, ok)
+	}
+	if !CompleteTwoFactorChallenge(c, challenge) {
+		t.Fatal("challenge not completed")
+	}
+	value, _ := c.Get(TwoFactorVerifiedKey)
+	if user := value.(*models.UserAuthorizations); !reflect.DeepEqual(*user, login) {
+		t.Errorf("verified identity = %+v, want %+v", *user, login)
+	}
+
+	// a challenge is used once
+	if CompleteTwoFactorChallenge(c, challenge) {
+		t.Error("challenge completed twice")
+	}
+}
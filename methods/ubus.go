@@ -10,25 +10,50 @@
 package methods
 
 import (
+	"context"
 	"encoding/json"
-	"io"
-	"net/http"
-	"os/exec"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
+	"github.com/Jeffail/gabs/v2"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/logs"
 	"github.com/NethServer/nethsecurity-api/models"
 	"github.com/NethServer/nethsecurity-api/response"
-	"github.com/NethServer/nethsecurity-api/logs"
-	"github.com/Jeffail/gabs/v2"
+	"github.com/NethServer/nethsecurity-api/ubus"
 	"github.com/fatih/structs"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 )
 
+// UBusErrorStatus maps the error of a ubus call to an HTTP status code
+func UBusErrorStatus(err error) int {
+	var statusErr *ubus.StatusError
+	if !errors.As(err, &statusErr) {
+		return http.StatusInternalServerError
+	}
+
+	switch statusErr.Code {
+	case ubus.StatusInvalidArgument:
+		return http.StatusBadRequest
+	case ubus.StatusMethodNotFound, ubus.StatusNotFound:
+		return http.StatusNotFound
+	case ubus.StatusPermissionDenied:
+		return http.StatusForbidden
+	case ubus.StatusTimeout:
+		return http.StatusGatewayTimeout
+	case ubus.StatusNotSupported:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
 func UBusCallAction(c *gin.Context) {
 	// parse request fields
 	var jsonUBusCall models.UBusCallJSON
-	var cmd *exec.Cmd
 	if err := c.ShouldBindBodyWith(&jsonUBusCall, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    400,
@@ -38,72 +63,60 @@ func UBusCallAction(c *gin.Context) {
 		return
 	}
 
+	// execute call and return its response
+	code, result := ExecuteUBusCall(c.Request.Context(), jsonUBusCall)
+	if code == http.StatusForbidden {
+		c.AbortWithStatusJSON(code, result)
+		return
+	}
+	c.JSON(code, result)
+}
+
+// ExecuteUBusCall checks the call against the ubus policy, runs it and returns the HTTP status code
+// with the response body
+func ExecuteUBusCall(ctx context.Context, jsonUBusCall models.UBusCallJSON) (int, map[string]interface{}) {
+	// check if path and method are allowed by the policy
+	if !configuration.UBusAllowed(jsonUBusCall.Path, jsonUBusCall.Method) {
+		return http.StatusForbidden, structs.Map(response.StatusBadRequest{
+			Code:    403,
+			Message: "ubus call action forbidden",
+			Data:    "method not allowed",
+		})
+	}
+
+	out, err := RunUBusCall(ctx, jsonUBusCall)
+	return UBusCallResult(out, err)
+}
+
+// RunUBusCall executes the call, ns.* paths run the rpcd script directly while other paths are
+// called through ubusd
+func RunUBusCall(ctx context.Context, jsonUBusCall models.UBusCallJSON) ([]byte, error) {
 	// convert payload to JSON
 	jsonPayload, _ := json.Marshal(jsonUBusCall.Payload)
 
 	// check if path starts with ns.
-	if jsonUBusCall.Path[:3] == "ns." {
-		// force base path to avoid calling other system binaries
-		jsonUBusCall.Path = "/usr/libexec/rpcd/" + jsonUBusCall.Path
-		cmd = exec.Command(jsonUBusCall.Path, "call", jsonUBusCall.Method)
-
-		// execute direct script call
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			// log full response for debugging if ubus call fails
-			logs.Logs.Println("[ERROR][UBUS][STDIN] ubus stdin pipe error:", err.Error())
-			c.JSON(http.StatusInternalServerError, structs.Map(response.StatusBadRequest{
-				Code:    500,
-				Message: "ubus call action failed",
-				Data:    err.Error(),
-			}))
-			return
-		}
-
-		io.WriteString(stdin, string(jsonPayload))
-		stdin.Close()
-	} else {
-		// check if path is authorized
-		var authorizedPaths = map[string][]string{
-			"uci":               {"get", "set", "changes", "revert"},
-			"luci":              {"getTimezones", "setInitAction"},
-			"system":            {"info", "board"},
-			"network.interface": {"dump"},
-		}
-		var forbidden = true
-		if authorizedPaths[jsonUBusCall.Path] != nil {
-			for _, method := range authorizedPaths[jsonUBusCall.Path] {
-				if method == jsonUBusCall.Method {
-					forbidden = false
-					break
-				}
-			}
-		}
-		if forbidden {
-			c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusBadRequest{
-				Code:    403,
-				Message: "ubus call action forbidden",
-				Data:    "method not allowed",
-			}))
-			return
-		}
-
-		// fallback to rpcd
-		cmd = exec.Command("/bin/ubus", "-S", "-t", "300", "call", jsonUBusCall.Path, jsonUBusCall.Method, string(jsonPayload[:]))
+	if strings.HasPrefix(jsonUBusCall.Path, "ns.") {
+		// force base path to avoid calling other system binaries, execute direct script call
+		return executor.Default.Run(ctx, "/usr/libexec/rpcd/"+jsonUBusCall.Path, []string{"call", jsonUBusCall.Method}, jsonPayload)
 	}
 
+	// call rpcd through ubusd
+	return executor.Default.Call(ctx, jsonUBusCall.Path, jsonUBusCall.Method, jsonUBusCall.Payload)
+}
+
+// UBusCallResult converts the output of a call to the HTTP status code and response body
+func UBusCallResult(out []byte, err error) (int, map[string]interface{}) {
 	// check errors
-	out, err := cmd.CombinedOutput()
 	if err != nil {
 		// log full response for debugging if ubus call fails
 		logs.Logs.Println("[ERROR][UBUS][PROCESS] ubus execution error:", err.Error())
 		logs.Logs.Println("[ERROR][UBUS][OUTPUT] ubus execution output:", string(out))
-		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusBadRequest{
-			Code:    500,
+		code := UBusErrorStatus(err)
+		return code, structs.Map(response.StatusBadRequest{
+			Code:    code,
 			Message: "ubus call action failed",
 			Data:    err.Error(),
-		}))
-		return
+		})
 	}
 
 	// parse output in a valid JSON
@@ -118,29 +131,27 @@ func UBusCallAction(c *gin.Context) {
 			errorMessage,
 			jsonParsed.String(),
 		))
-		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusBadRequest{
+		return http.StatusInternalServerError, structs.Map(response.StatusBadRequest{
 			Code:    500,
 			Message: errorMessage,
 			Data:    jsonParsed,
-		}))
-		return
+		})
 	}
 
 	// check validation error in response
 	validationFound := jsonParsed.Exists("validation")
 	if validationFound {
-		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+		return http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    400,
 			Message: "validation_failed",
 			Data:    jsonParsed,
-		}))
-		return
+		})
 	}
 
 	// return 200 OK with data
-	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+	return http.StatusOK, structs.Map(response.StatusOK{
 		Code:    200,
 		Message: "ubus call action success",
 		Data:    jsonParsed,
-	}))
+	})
 }
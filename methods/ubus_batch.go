@@ -0,0 +1,135 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// UBusBatchAction executes many ubus calls in a single request, each call goes through the same
+// role, sudo and policy checks of UBusCallAction and gets its own status code. The body is the
+// array of calls, stop_on_error and parallelism are query parameters
+func UBusBatchAction(c *gin.Context) {
+	// parse request fields
+	var jsonBatch models.UBusBatchJSON
+	if err := c.ShouldBindBodyWith(&jsonBatch, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// parse options
+	stopOnError := false
+	parallelism := 0
+	var err error
+	if value := c.Query("stop_on_error"); value != "" {
+		stopOnError, err = strconv.ParseBool(value)
+	}
+	if value := c.Query("parallelism"); value != "" && err == nil {
+		parallelism, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    "stop_on_error must be a boolean, parallelism a number",
+		}))
+		return
+	}
+
+	// check batch size
+	if len(jsonBatch) > configuration.Config.UBusBatchMaxCalls {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "too many calls in batch",
+			Data:    "max calls: " + strconv.Itoa(configuration.Config.UBusBatchMaxCalls),
+		}))
+		return
+	}
+
+	// bound parallelism to configured maximum, stop on error runs calls one at a time so that
+	// nothing runs after the first failure
+	if parallelism <= 0 || parallelism > configuration.Config.UBusBatchParallelism {
+		parallelism = configuration.Config.UBusBatchParallelism
+	}
+	if parallelism < 1 || stopOnError {
+		parallelism = 1
+	}
+
+	claims := jwt.ExtractClaims(c)
+	results := make([]map[string]interface{}, len(jsonBatch))
+	slots := make(chan struct{}, parallelism)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+
+	for i, jsonUBusCall := range jsonBatch {
+		// wait for a free slot, then skip remaining calls if one has failed
+		slots <- struct{}{}
+		if stopOnError && failed.Load() {
+			<-slots
+			results[i] = structs.Map(response.StatusFailedDependency{
+				Code:    http.StatusFailedDependency,
+				Message: "ubus call action skipped",
+				Data:    "previous call failed",
+			})
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, jsonUBusCall models.UBusCallJSON) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// check role and sudo rules of the single call
+			if allowed, message := CheckUBusAuthorization(claims, jsonUBusCall); !allowed {
+				logs.Logs.Println("[INFO][UBUS] batch call forbidden for user " + claims["id"].(string) + ". " + jsonUBusCall.Path + " " + jsonUBusCall.Method + ": " + message)
+				results[i] = structs.Map(response.StatusForbidden{
+					Code:    http.StatusForbidden,
+					Message: message,
+					Data:    "method not allowed",
+				})
+				failed.Store(true)
+				return
+			}
+
+			code, result := ExecuteUBusCall(c.Request.Context(), jsonUBusCall)
+			results[i] = result
+			if code != http.StatusOK {
+				failed.Store(true)
+			}
+		}(i, jsonUBusCall)
+	}
+	wg.Wait()
+
+	// every call is audited with its own result
+	for i, jsonUBusCall := range jsonBatch {
+		code, _ := results[i]["code"].(int)
+		audit.AddItem(c, jsonUBusCall.Path+" "+jsonUBusCall.Method, code)
+	}
+
+	// return 200 OK with the result of every call
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "ubus batch action completed",
+		Data:    results,
+	}))
+}
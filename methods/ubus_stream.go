@@ -0,0 +1,88 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// UBusStreamAction executes a ubus call like UBusCallAction, sending the output lines of ns.*
+// scripts as Server-Sent Events while they are printed, followed by a final `result` event
+func UBusStreamAction(c *gin.Context) {
+	// parse request fields
+	var jsonUBusCall models.UBusCallJSON
+	if err := c.ShouldBindBodyWith(&jsonUBusCall, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// check if path and method are allowed by the policy, before starting the stream
+	if !configuration.UBusAllowed(jsonUBusCall.Path, jsonUBusCall.Method) {
+		c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusBadRequest{
+			Code:    403,
+			Message: "ubus call action forbidden",
+			Data:    "method not allowed",
+		}))
+		return
+	}
+
+	// start event stream, disable proxy buffering
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// lines of stdout and stderr are sent from different goroutines
+	var writeLock sync.Mutex
+	send := func(event string, data interface{}) {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	var out []byte
+	var err error
+	if strings.HasPrefix(jsonUBusCall.Path, "ns.") {
+		// force base path to avoid calling other system binaries, stream direct script call
+		jsonPayload, _ := json.Marshal(jsonUBusCall.Payload)
+		out, err = executor.Default.Stream(c.Request.Context(), "/usr/libexec/rpcd/"+jsonUBusCall.Path, []string{"call", jsonUBusCall.Method}, jsonPayload, func(stream string, line string) {
+			send(stream, line)
+		})
+
+		// progress lines precede the JSON result, which is printed last
+		if !json.Valid(out) {
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			out = []byte(lines[len(lines)-1])
+		}
+	} else {
+		// rpcd methods have no progress output, only the result is sent
+		out, err = RunUBusCall(c.Request.Context(), jsonUBusCall)
+	}
+
+	// send parsed result, with the same body of UBusCallAction, the stream is audited with its status
+	code, result := UBusCallResult(out, err)
+	audit.SetStatus(c, code)
+	send("result", result)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/store"
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logs.Init("nethsecurity_api_test")
+
+	// configuration files are missing, defaults are used
+	dir, err := os.MkdirTemp("", "nethsecurity-api-test")
+	if err != nil {
+		panic(err)
+	}
+	configuration.Config.SecretsDir = filepath.Join(dir, "secrets")
+	configuration.Config.UBusPolicyFile = filepath.Join(dir, "ubus_policy.json")
+	configuration.Config.AuthBackends = []string{"local"}
+	configuration.Config.AuthTimeout = 5
+	configuration.Config.TwoFactorTimeout = 300
+	configuration.Config.Issuer2FA = "NethServer"
+	configuration.Config.LockoutMaxFailures = 5
+	configuration.Config.LockoutMaxFailuresIP = 20
+	configuration.Config.LockoutBase = 30
+	configuration.Config.LockoutMax = 900
+	if err := configuration.LoadUBusPolicy(); err != nil {
+		panic(err)
+	}
+	if store.Tokens, err = store.OpenBoltTokenStore(filepath.Join(dir, "tokens.db")); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	store.Tokens.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useFake replaces the default executor for the duration of the test
+func useFake(t *testing.T) *executor.Fake {
+	fake := executor.NewFake()
+	previous := executor.Default
+	executor.Default = fake
+	t.Cleanup(func() { executor.Default = previous })
+	return fake
+}
+
+// decodeBody returns the JSON body of the response
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder) map[string]interface{} {
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", recorder.Body.String(), err)
+	}
+	return body
+}
+
+func TestUBusCallAction(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		script  func(fake *executor.Fake)
+		status  int
+		message string
+		data    string
+	}{
+		{
+			name:    "success",
+			request: `{"path": "system", "method": "board", "payload": {}}`,
+			script: func(fake *executor.Fake) {
+				fake.OnCall("system", "board", `{"hostname": "fw"}`, nil)
+			},
+			status:  http.StatusOK,
+			message: "ubus call action success",
+			data:    `{"hostname":"fw"}`,
+		},
+		{
+			name:    "error in response",
+			request: `{"path": "ns.dhcp", "method": "list-interfaces", "payload": {}}`,
+			script: func(fake *executor.Fake) {
+				fake.OnScript("ns.dhcp", "list-interfaces", `{"error": "interface_not_found"}`, 0)
+			},
+			status:  http.StatusInternalServerError,
+			message: "interface_not_found",
+			data:    `{"error":"interface_not_found"}`,
+		},
+		{
+			name:    "validation in response",
+			request: `{"path": "ns.dhcp", "method": "edit-interface", "payload": {"first": ""}}`,
+			script: func(fake *executor.Fake) {
+				fake.OnScript("ns.dhcp", "edit-interface", `{"validation": {"errors": [{"parameter": "first", "message": "required", "value": ""}]}}`, 0)
+			},
+			status:  http.StatusBadRequest,
+			message: "validation_failed",
+			data:    `{"validation":{"errors":[{"message":"required","parameter":"first","value":""}]}}`,
+		},
+		{
+			name:    "non-zero exit",
+			request: `{"path": "ns.dhcp", "method": "list-interfaces", "payload": {}}`,
+			script: func(fake *executor.Fake) {
+				fake.OnScript("ns.dhcp", "list-interfaces", "Traceback", 1)
+			},
+			status:  http.StatusInternalServerError,
+			message: "ubus call action failed",
+			data:    `"exit status 1"`,
+		},
+		{
+			name:    "ubus status",
+			request: `{"path": "system", "method": "info", "payload": {}}`,
+			script: func(fake *executor.Fake) {
+				fake.OnCall("system", "info", "", &ubus.StatusError{Code: ubus.StatusPermissionDenied})
+			},
+			status:  http.StatusForbidden,
+			message: "ubus call action failed",
+		},
+		{
+			name:    "forbidden by policy",
+			request: `{"path": "file", "method": "exec", "payload": {}}`,
+			script:  func(fake *executor.Fake) {},
+			status:  http.StatusForbidden,
+			message: "ubus call action forbidden",
+			data:    `"method not allowed"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFake(t)
+			tt.script(fake)
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/ubus/call", strings.NewReader(tt.request))
+			c.Request.Header.Set("Content-Type", "application/json")
+			UBusCallAction(c)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+			body := decodeBody(t, recorder)
+			if body["message"] != tt.message {
+				t.Errorf("message = %v, want %q", body["message"], tt.message)
+			}
+			if body["code"] != float64(tt.status) {
+				t.Errorf("code = %v, want %d", body["code"], tt.status)
+			}
+			if tt.data != "" {
+				data, _ := json.Marshal(body["data"])
+				if string(data) != tt.data {
+					t.Errorf("data = %s, want %s", data, tt.data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,699 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/store"
+)
+
+// webAuthnCeremonyTimeout is how long a registration or login ceremony can last
+const webAuthnCeremonyTimeout = 5 * time.Minute
+
+// pending ceremonies, by "register:<username>" or "login:<token id>"
+var webAuthnSessions = map[string]*webauthn.SessionData{}
+var webAuthnSessionsLock sync.Mutex
+
+// serializes changes to the credentials files
+var webAuthnCredentialsLock sync.Mutex
+
+// webAuthnUser adapts the stored credentials of a user to the webauthn.User interface
+type webAuthnUser struct {
+	username string
+	data     *models.WebAuthnCredentials
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+	return u.data.UserID
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+	return u.username
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	return u.username
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := []webauthn.Credential{}
+	for _, credential := range u.data.Credentials {
+		credentials = append(credentials, credential.Credential)
+	}
+	return credentials
+}
+
+// GetWebAuthnCredentials reads the WebAuthn credentials of the user, an empty list if there are none
+func GetWebAuthnCredentials(username string) (*models.WebAuthnCredentials, error) {
+	data := &models.WebAuthnCredentials{Credentials: []models.WebAuthnCredential{}}
+
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(dir + "/webauthn.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SetWebAuthnCredentials writes the WebAuthn credentials of the user
+func SetWebAuthnCredentials(username string, data *models.WebAuthnCredentials) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	// write a temporary file and move it, to never leave a truncated file
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dir+"/webauthn.json.tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(dir+"/webauthn.json.tmp", dir+"/webauthn.json")
+}
+
+// SetUserStatus writes the 2FA status of the user, "1" enabled and "0" disabled
+func SetUserStatus(username string, status string) error {
+	dir, err := UserSecretsDir(username)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(dir+"/status", []byte(status), 0600)
+}
+
+// webAuthnFor returns the configured relying party, rp id and origins are never derived from the
+// request because its headers are chosen by the client
+func webAuthnFor(c *gin.Context) (*webauthn.WebAuthn, bool) {
+	if configuration.Config.WebAuthnRPID == "" || len(configuration.Config.WebAuthnRPOrigins) == 0 {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "webauthn not configured",
+			Data:    nil,
+		}))
+		return nil, false
+	}
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          configuration.Config.WebAuthnRPID,
+		RPDisplayName: configuration.Config.Issuer2FA,
+		RPOrigins:     configuration.Config.WebAuthnRPOrigins,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn configuration error",
+			Data:    err.Error(),
+		}))
+		return nil, false
+	}
+	return wa, true
+}
+
+// setWebAuthnSession stores the data of a ceremony, removing the expired ones
+func setWebAuthnSession(key string, session *webauthn.SessionData) {
+	webAuthnSessionsLock.Lock()
+	defer webAuthnSessionsLock.Unlock()
+
+	now := time.Now()
+	for k, s := range webAuthnSessions {
+		if s.Expires.Before(now) {
+			delete(webAuthnSessions, k)
+		}
+	}
+
+	session.Expires = now.Add(webAuthnCeremonyTimeout)
+	webAuthnSessions[key] = session
+}
+
+// popWebAuthnSession returns the data of a ceremony, it can be used only once
+func popWebAuthnSession(key string) (*webauthn.SessionData, bool) {
+	webAuthnSessionsLock.Lock()
+	defer webAuthnSessionsLock.Unlock()
+
+	session, ok := webAuthnSessions[key]
+	delete(webAuthnSessions, key)
+	if !ok || session.Expires.Before(time.Now()) {
+		return nil, false
+	}
+	return session, true
+}
+
+// webAuthnValidationError returns the validation error of an invalid credential
+func webAuthnValidationError(c *gin.Context) {
+	jsonParsed, _ := gabs.ParseJSON([]byte(`{
+		"validation": {
+		  "errors": [
+			{
+			  "message": "invalid_credential",
+			  "parameter": "credential",
+			  "value": ""
+			}
+		  ]
+		}
+	}`))
+
+	c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+		Code:    400,
+		Message: "validation_failed",
+		Data:    jsonParsed,
+	}))
+}
+
+// webAuthnOptions converts the options of a ceremony to JSON, keeping the field names expected by browsers
+func webAuthnOptions(options interface{}) *gabs.Container {
+	content, _ := json.Marshal(options)
+	jsonParsed, _ := gabs.ParseJSON(content)
+	return jsonParsed
+}
+
+// webAuthnPendingUser returns the user of the pending login challenge
+func webAuthnPendingUser(c *gin.Context, jsonLogin models.WebAuthnLoginJSON) (string, bool) {
+	username, ok := GetTwoFactorChallenge(c, jsonLogin.Challenge)
+	if !ok {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "2FA challenge invalid or expired",
+			Data:    "",
+		}))
+		return "", false
+	}
+	return username, true
+}
+
+func WebAuthnRegisterBegin(c *gin.Context) {
+	// get claims from token
+	claims := jwt.ExtractClaims(c)
+	username := claims["id"].(string)
+
+	// read current credentials
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil {
+		logs.Logs.Println("[ERR][2FA] cannot read webauthn credentials of user " + username + ": " + err.Error())
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// generate the user handle on first registration
+	if len(data.UserID) == 0 {
+		data.UserID = make([]byte, 64)
+		if _, err := rand.Read(data.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+				Code:    500,
+				Message: "webauthn user handle error",
+				Data:    err.Error(),
+			}))
+			return
+		}
+	}
+
+	wa, ok := webAuthnFor(c)
+	if !ok {
+		return
+	}
+
+	// exclude credentials already registered
+	user := webAuthnUser{username: username, data: data}
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := wa.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "webauthn registration error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	setWebAuthnSession("register:"+username, session)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "webauthn registration started",
+		Data:    webAuthnOptions(creation),
+	}))
+}
+
+func WebAuthnRegisterFinish(c *gin.Context) {
+	// get claims from token
+	claims := jwt.ExtractClaims(c)
+	username := claims["id"].(string)
+
+	// parse request fields
+	var jsonRegister models.WebAuthnRegisterJSON
+	if err := c.ShouldBindBodyWith(&jsonRegister, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// get pending ceremony
+	session, ok := popWebAuthnSession("register:" + username)
+	if !ok {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "webauthn registration not started or expired",
+			Data:    "",
+		}))
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(jsonRegister.Credential)
+	if err != nil {
+		logs.Logs.Println("[INFO][2FA] invalid webauthn registration for user " + username + ": " + err.Error())
+		webAuthnValidationError(c)
+		return
+	}
+
+	wa, ok := webAuthnFor(c)
+	if !ok {
+		return
+	}
+
+	webAuthnCredentialsLock.Lock()
+	defer webAuthnCredentialsLock.Unlock()
+
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	if len(data.UserID) == 0 {
+		data.UserID = session.UserID
+	}
+
+	// verify attestation
+	credential, err := wa.CreateCredential(webAuthnUser{username: username, data: data}, *session, parsed)
+	if err != nil {
+		logs.Logs.Println("[INFO][2FA] invalid webauthn registration for user " + username + ": " + err.Error())
+		webAuthnValidationError(c)
+		return
+	}
+
+	// save credential
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	data.Credentials = append(data.Credentials, models.WebAuthnCredential{
+		ID:         id,
+		Name:       jsonRegister.Name,
+		CreatedAt:  time.Now(),
+		Credential: *credential,
+	})
+	if err := SetWebAuthnCredentials(username, data); err != nil {
+		logs.Logs.Println("[ERR][2FA] cannot write webauthn credentials of user " + username + ": " + err.Error())
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials write error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// when 2FA gets enabled, clean all previous tokens except the current one
+	status, _ := GetUserStatus(username)
+	if status != "1" {
+		token := jwt.GetToken(c)
+		if err := store.Tokens.DeleteUser(username); err != nil {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "clean previous tokens error",
+				Data:    err,
+			}))
+			return
+		}
+		SetTokenValidation(username, token, c.ClientIP(), c.Request.UserAgent())
+
+		if err := SetUserStatus(username, "1"); err != nil {
+			c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "status set error",
+				Data:    err,
+			}))
+			return
+		}
+	}
+
+	logs.Logs.Println("[INFO][2FA] webauthn credential " + jsonRegister.Name + " registered for user " + username)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "webauthn credential registered",
+		Data:    gin.H{"id": id},
+	}))
+}
+
+func WebAuthnLoginBegin(c *gin.Context) {
+	// parse request fields
+	var jsonLogin models.WebAuthnLoginJSON
+	if err := c.ShouldBindBodyWith(&jsonLogin, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// get user of pending login
+	username, ok := webAuthnPendingUser(c, jsonLogin)
+	if !ok {
+		return
+	}
+
+	// refuse attempts of locked users and clients
+	if !CheckAuthLockout(c, username) {
+		return
+	}
+
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil || len(data.Credentials) == 0 {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "webauthn credentials not found",
+			Data:    "",
+		}))
+		return
+	}
+
+	wa, ok := webAuthnFor(c)
+	if !ok {
+		return
+	}
+
+	assertion, session, err := wa.BeginLogin(webAuthnUser{username: username, data: data})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "webauthn login error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	setWebAuthnSession("login:"+jsonLogin.Challenge, session)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "webauthn login started",
+		Data:    webAuthnOptions(assertion),
+	}))
+}
+
+func WebAuthnLoginFinish(c *gin.Context) {
+	// parse request fields
+	var jsonLogin models.WebAuthnLoginJSON
+	if err := c.ShouldBindBodyWith(&jsonLogin, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// get user of pending login
+	username, ok := webAuthnPendingUser(c, jsonLogin)
+	if !ok {
+		return
+	}
+
+	// refuse attempts of locked users and clients
+	if !CheckAuthLockout(c, username) {
+		return
+	}
+
+	// get pending ceremony
+	session, ok := popWebAuthnSession("login:" + jsonLogin.Challenge)
+	if !ok {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "webauthn login not started or expired",
+			Data:    "",
+		}))
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(jsonLogin.Credential)
+	if err != nil {
+		RegisterAuthFailure(username, c.ClientIP())
+		FailTwoFactorChallenge(jsonLogin.Challenge)
+		logs.Logs.Println("[INFO][2FA] invalid webauthn assertion for user " + username + " from " + c.ClientIP() + ": " + err.Error())
+		webAuthnValidationError(c)
+		return
+	}
+
+	wa, ok := webAuthnFor(c)
+	if !ok {
+		return
+	}
+
+	webAuthnCredentialsLock.Lock()
+	defer webAuthnCredentialsLock.Unlock()
+
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// verify assertion
+	credential, err := wa.ValidateLogin(webAuthnUser{username: username, data: data}, *session, parsed)
+	if err != nil {
+		RegisterAuthFailure(username, c.ClientIP())
+		FailTwoFactorChallenge(jsonLogin.Challenge)
+		logs.Logs.Println("[INFO][2FA] invalid webauthn assertion for user " + username + " from " + c.ClientIP() + ": " + err.Error())
+		webAuthnValidationError(c)
+		return
+	}
+
+	// update signature counter and last use
+	now := time.Now()
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	for i := range data.Credentials {
+		if data.Credentials[i].ID == id {
+			data.Credentials[i].Credential.Authenticator = credential.Authenticator
+			data.Credentials[i].LastUsedAt = &now
+		}
+	}
+	if err := SetWebAuthnCredentials(username, data); err != nil {
+		logs.Logs.Println("[ERR][2FA] cannot write webauthn credentials of user " + username + ": " + err.Error())
+	}
+
+	// reset failed attempts
+	RegisterAuthSuccess(username)
+
+	// complete pending login, the session token is issued by the next handler
+	if !CompleteTwoFactorChallenge(c, jsonLogin.Challenge) {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "2FA challenge invalid or expired",
+			Data:    "",
+		}))
+	}
+}
+
+func WebAuthnListCredentials(c *gin.Context) {
+	// get claims from token
+	claims := jwt.ExtractClaims(c)
+
+	data, err := GetWebAuthnCredentials(claims["id"].(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// return credentials without key material
+	credentials := []gin.H{}
+	for _, credential := range data.Credentials {
+		credentials = append(credentials, gin.H{
+			"id":           credential.ID,
+			"name":         credential.Name,
+			"created_at":   credential.CreatedAt,
+			"last_used_at": credential.LastUsedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "webauthn credentials list",
+		Data:    credentials,
+	}))
+}
+
+func WebAuthnRenameCredential(c *gin.Context) {
+	// get claims from token
+	claims := jwt.ExtractClaims(c)
+	username := claims["id"].(string)
+
+	// parse request fields
+	var jsonRename models.WebAuthnRenameJSON
+	if err := c.ShouldBindBodyWith(&jsonRename, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    400,
+			Message: "request fields malformed",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	webAuthnCredentialsLock.Lock()
+	defer webAuthnCredentialsLock.Unlock()
+
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	found := false
+	for i := range data.Credentials {
+		if data.Credentials[i].ID == c.Param("id") {
+			data.Credentials[i].Name = jsonRename.Name
+			found = true
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "webauthn credential not found",
+			Data:    "",
+		}))
+		return
+	}
+
+	if err := SetWebAuthnCredentials(username, data); err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials write error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "webauthn credential renamed",
+		Data:    "",
+	}))
+}
+
+func WebAuthnDeleteCredential(c *gin.Context) {
+	// get claims from token
+	claims := jwt.ExtractClaims(c)
+	username := claims["id"].(string)
+
+	webAuthnCredentialsLock.Lock()
+	defer webAuthnCredentialsLock.Unlock()
+
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials read error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	credentials := []models.WebAuthnCredential{}
+	for _, credential := range data.Credentials {
+		if credential.ID != c.Param("id") {
+			credentials = append(credentials, credential)
+		}
+	}
+	if len(credentials) == len(data.Credentials) {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "webauthn credential not found",
+			Data:    "",
+		}))
+		return
+	}
+	data.Credentials = credentials
+
+	if err := SetWebAuthnCredentials(username, data); err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "webauthn credentials write error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// disable 2FA when the last second factor is removed
+	if len(credentials) == 0 && len(GetUserSecret(username)) == 0 {
+		if err := SetUserStatus(username, "0"); err != nil {
+			logs.Logs.Println("[ERR][2FA] cannot disable 2FA for user " + username + ": " + err.Error())
+		}
+	}
+
+	logs.Logs.Println("[INFO][2FA] webauthn credential " + c.Param("id") + " deleted for user " + username)
+
+	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
+		Code:    200,
+		Message: "webauthn credential deleted",
+		Data:    "",
+	}))
+}
@@ -0,0 +1,315 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package methods
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+const (
+	webAuthnTestRPID   = "fw.example.org"
+	webAuthnTestOrigin = "https://fw.example.org"
+	webAuthnTestIP     = "192.0.2.10"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a software WebAuthn authenticator with a single P-256 credential and "none"
+// attestation, like the virtual authenticators of browsers
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	userID    []byte
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 32)
+	rand.Read(id)
+	return &softAuthenticator{key: key, id: id}
+}
+
+// authenticatorData returns the data signed by the authenticator, with the attested credential
+// when registering
+func (a *softAuthenticator) authenticatorData(t *testing.T, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(webAuthnTestRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+
+	// user present, attested credential data included
+	flags := byte(0x01)
+	if attested {
+		flags |= 0x40
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	if attested {
+		publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{
+				KeyType:   int64(webauthncose.EllipticKey),
+				Algorithm: int64(webauthncose.AlgES256),
+			},
+			Curve:  1,
+			XCoord: a.key.X.FillBytes(make([]byte, 32)),
+			YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+// clientData returns the client data JSON built by the browser for the challenge
+func clientData(ceremony string, challenge string) []byte {
+	content, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    webAuthnTestOrigin,
+	})
+	return content
+}
+
+// create answers the options of WebAuthnRegisterBegin
+func (a *softAuthenticator) create(t *testing.T, options map[string]interface{}) json.RawMessage {
+	publicKey := options["publicKey"].(map[string]interface{})
+	userID, err := b64.DecodeString(publicKey["user"].(map[string]interface{})["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userID = userID
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(t, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData("webauthn.create", publicKey["challenge"].(string))),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+	return content
+}
+
+// get answers the options of WebAuthnLoginBegin, signing with the given key
+func (a *softAuthenticator) get(t *testing.T, options map[string]interface{}, key *ecdsa.PrivateKey) json.RawMessage {
+	publicKey := options["publicKey"].(map[string]interface{})
+	a.signCount++
+
+	authData := a.authenticatorData(t, false)
+	client := clientData("webauthn.get", publicKey["challenge"].(string))
+	clientHash := sha256.Sum256(client)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(client),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userID),
+		},
+	})
+	return content
+}
+
+// webAuthnRequest runs the handler with a JSON body, as the user when username is not empty
+func webAuthnRequest(t *testing.T, handler gin.HandlerFunc, username string, body interface{}) (*httptest.ResponseRecorder, *gin.Context) {
+	content, _ := json.Marshal(body)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/2fa/webauthn", strings.NewReader(string(content)))
+	// the relying party is never derived from the host
+	c.Request.Host = "attacker.example.com"
+	c.Request.RemoteAddr = webAuthnTestIP + ":40000"
+	c.Request.Header.Set("Content-Type", "application/json")
+	if username != "" {
+		c.Set("JWT_PAYLOAD", jwt.MapClaims{"id": username})
+	}
+	handler(c)
+	return recorder, c
+}
+
+// webAuthnOptionsOf returns the ceremony options of a begin response
+func webAuthnOptionsOf(t *testing.T, recorder *httptest.ResponseRecorder) map[string]interface{} {
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200, body %s", recorder.Code, recorder.Body.String())
+	}
+	return decodeBody(t, recorder)["data"].(map[string]interface{})
+}
+
+// useWebAuthnConfig sets the relying party for the duration of the test
+func useWebAuthnConfig(t *testing.T, rpID string, origins []string) {
+	previousID, previousOrigins := configuration.Config.WebAuthnRPID, configuration.Config.WebAuthnRPOrigins
+	configuration.Config.WebAuthnRPID, configuration.Config.WebAuthnRPOrigins = rpID, origins
+	t.Cleanup(func() {
+		configuration.Config.WebAuthnRPID, configuration.Config.WebAuthnRPOrigins = previousID, previousOrigins
+	})
+}
+
+func TestWebAuthnNotConfigured(t *testing.T) {
+	tests := []struct {
+		name    string
+		rpID    string
+		origins []string
+	}{
+		{name: "nothing"},
+		{name: "rp id only", rpID: webAuthnTestRPID},
+		{name: "origins only", origins: []string{webAuthnTestOrigin}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useWebAuthnConfig(t, tt.rpID, tt.origins)
+
+			recorder, _ := webAuthnRequest(t, WebAuthnRegisterBegin, "unconfigured", nil)
+			if recorder.Code != http.StatusNotFound || decodeBody(t, recorder)["message"] != "webauthn not configured" {
+				t.Errorf("register begin status = %d, body %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	const username = "webauthn"
+	useWebAuthnConfig(t, webAuthnTestRPID, []string{webAuthnTestOrigin})
+	authenticator := newSoftAuthenticator(t)
+
+	// register credential
+	recorder, _ := webAuthnRequest(t, WebAuthnRegisterBegin, username, nil)
+	credential := authenticator.create(t, webAuthnOptionsOf(t, recorder))
+	recorder, _ = webAuthnRequest(t, WebAuthnRegisterFinish, username, gin.H{"name": "soft key", "credential": credential})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("register finish status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	if status, _ := GetUserStatus(username); status != "1" {
+		t.Errorf("2FA status = %q after registration, want 1", status)
+	}
+	if methods := TwoFactorMethods(username); len(methods) != 1 || methods[0] != "webauthn" {
+		t.Errorf("2FA methods = %v, want [webauthn]", methods)
+	}
+
+	// registration ceremony cannot be replayed
+	recorder, _ = webAuthnRequest(t, WebAuthnRegisterFinish, username, gin.H{"name": "soft key", "credential": credential})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("replayed register finish status = %d, want 400", recorder.Code)
+	}
+
+	// login with a key that is not the registered one
+	challenge, _, err := NewTwoFactorChallenge(models.UserAuthorizations{Username: username}, webAuthnTestIP, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, _ = webAuthnRequest(t, WebAuthnLoginBegin, "", gin.H{"challenge": challenge})
+	wrongKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assertion := authenticator.get(t, webAuthnOptionsOf(t, recorder), wrongKey)
+	recorder, c := webAuthnRequest(t, WebAuthnLoginFinish, "", gin.H{"challenge": challenge, "credential": assertion})
+	if recorder.Code != http.StatusBadRequest || decodeBody(t, recorder)["message"] != "validation_failed" {
+		t.Errorf("wrong key login status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	if _, ok := c.Get(TwoFactorVerifiedKey); ok {
+		t.Error("login verified with a wrong key")
+	}
+
+	// login with the registered key
+	recorder, _ = webAuthnRequest(t, WebAuthnLoginBegin, "", gin.H{"challenge": challenge})
+	assertion = authenticator.get(t, webAuthnOptionsOf(t, recorder), authenticator.key)
+	recorder, c = webAuthnRequest(t, WebAuthnLoginFinish, "", gin.H{"challenge": challenge, "credential": assertion})
+	// on success the token is written by the next handler
+	if recorder.Body.Len() > 0 {
+		t.Fatalf("login finish status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	if verified, ok := c.Get(TwoFactorVerifiedKey); !ok || verified.(*models.UserAuthorizations).Username != username {
+		t.Fatalf("verified user = %v, want %s", verified, username)
+	}
+
+	// signature counter is saved
+	data, err := GetWebAuthnCredentials(username)
+	if err != nil || len(data.Credentials) != 1 {
+		t.Fatalf("credentials = %+v, %v", data, err)
+	}
+	if data.Credentials[0].Credential.Authenticator.SignCount != authenticator.signCount || data.Credentials[0].LastUsedAt == nil {
+		t.Errorf("sign count = %d, want %d", data.Credentials[0].Credential.Authenticator.SignCount, authenticator.signCount)
+	}
+
+	// challenge is used once
+	recorder, _ = webAuthnRequest(t, WebAuthnLoginBegin, "", gin.H{"challenge": challenge})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("used challenge status = %d, want 400", recorder.Code)
+	}
+
+	// challenge is bound to the client that sent the password
+	challenge, _, _ = NewTwoFactorChallenge(models.UserAuthorizations{Username: username}, "198.51.100.1", "")
+	recorder, _ = webAuthnRequest(t, WebAuthnLoginBegin, "", gin.H{"challenge": challenge})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("challenge of another client status = %d, want 400", recorder.Code)
+	}
+}
+
+func TestDel2FAStatusWebAuthnOnly(t *testing.T) {
+	const username = "webauthn-only"
+	useWebAuthnConfig(t, webAuthnTestRPID, []string{webAuthnTestOrigin})
+	authenticator := newSoftAuthenticator(t)
+
+	// register a credential without TOTP secret
+	recorder, _ := webAuthnRequest(t, WebAuthnRegisterBegin, username, nil)
+	credential := authenticator.create(t, webAuthnOptionsOf(t, recorder))
+	recorder, _ = webAuthnRequest(t, WebAuthnRegisterFinish, username, gin.H{"name": "soft key", "credential": credential})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("register finish status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder, _ = webAuthnRequest(t, Del2FAStatus, username, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("disable 2FA status = %d, body %s", recorder.Code, recorder.Body.String())
+	}
+	if status, _ := GetUserStatus(username); status != "0" {
+		t.Errorf("2FA status = %q after disabling, want 0", status)
+	}
+	if methods := TwoFactorMethods(username); len(methods) != 0 {
+		t.Errorf("2FA methods = %v after disabling, want none", methods)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/utils"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthMiddleware authenticates the request with an API key when the bearer token is one, with the
+// client certificate when there is no bearer token, otherwise with the JWT middleware
+func AuthMiddleware() gin.HandlerFunc {
+	jwtMiddleware := InstanceJWT().MiddlewareFunc()
+
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer"))
+
+		// check client certificate, verified by the TLS listener
+		if token == "" && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			certificate := c.Request.TLS.VerifiedChains[0][0]
+			claims, message := methods.CheckClientCert(certificate, c.ClientIP())
+			if message != "" {
+				logs.Logs.Println("[INFO][AUTH] client certificate authorization failed for " + certificate.Subject.String() + " from " + c.ClientIP() + ": " + message)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, structs.Map(response.StatusUnauthorized{
+					Code:    401,
+					Message: message,
+					Data:    nil,
+				}))
+				return
+			}
+			authorize(c, claims, "client certificate "+certificate.Subject.String())
+			return
+		}
+
+		if !strings.HasPrefix(token, methods.APIKeyPrefix) {
+			jwtMiddleware(c)
+			return
+		}
+
+		// check key
+		apiKey, message := methods.CheckAPIKey(token, c.ClientIP())
+		if message != "" {
+			logs.Logs.Println("[INFO][AUTH] api key authorization failed from " + c.ClientIP() + ": " + message)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, structs.Map(response.StatusUnauthorized{
+				Code:    401,
+				Message: message,
+				Data:    nil,
+			}))
+			return
+		}
+		authorize(c, methods.APIKeyClaims(apiKey), "api key "+apiKey.Name)
+	}
+}
+
+// authorize accepts a request authenticated without a token, exposing claims and identity like the
+// JWT middleware
+func authorize(c *gin.Context, claims jwt.MapClaims, name string) {
+	actions := methods.ClaimsActions(claims)
+
+	// keys reach only the routes used by automation
+	if _, ok := claims["api_key"]; ok && !utils.MatchAction(actions, "route", c.Request.URL.Path, c.Request.Method) {
+		logs.Logs.Println("[INFO][AUTH] route forbidden for " + name + ". " + c.Request.Method + " " + c.Request.RequestURI)
+		c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+			Code:    403,
+			Message: "route forbidden for api key",
+			Data:    nil,
+		}))
+		return
+	}
+
+	logs.Logs.Println("[INFO][AUTH] authorization success for " + name + ". " + c.Request.Method + " " + c.Request.RequestURI + " " + requestBody(c))
+
+	role, _ := claims["role"].(string)
+	provider, _ := claims["provider"].(string)
+	c.Set("JWT_PAYLOAD", claims)
+	c.Set(identityKey, &models.UserAuthorizations{
+		Username: claims[identityKey].(string),
+		Role:     role,
+		Provider: provider,
+		Actions:  actions,
+	})
+	c.Next()
+}
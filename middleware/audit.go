@@ -0,0 +1,110 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// AuditMiddleware records an audit event of the given type once the request is done, it must come
+// before the checks of the route to record refused requests too
+func AuditMiddleware(eventType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// ubus calls are identified by path and method, read before the handler consumes the body
+		target := ""
+		if eventType == models.AuditUBus && c.Request.Method == http.MethodPost {
+			target = ubusTarget(c)
+		}
+
+		c.Next()
+
+		// handlers can set user, type and target when the route does not tell them
+		if t := audit.Type(c); t != "" {
+			eventType = t
+		}
+		if t := audit.Target(c); t != "" {
+			target = t
+		}
+		if target == "" && len(c.Params) > 0 {
+			target = c.Params[0].Value
+		}
+		user := audit.User(c)
+		if id, ok := jwt.ExtractClaims(c)["id"].(string); ok && user == "" {
+			user = id
+		}
+
+		// result by status code
+		status := c.Writer.Status()
+		if s := audit.Status(c); s != 0 {
+			status = s
+		}
+		event := models.AuditEvent{
+			Time:     start,
+			Type:     eventType,
+			User:     user,
+			IP:       c.ClientIP(),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Target:   target,
+			Result:   auditResult(status),
+			Status:   status,
+			Duration: time.Since(start).Milliseconds(),
+		}
+
+		// requests made of many operations are recorded once for each of them
+		items := audit.Items(c)
+		if len(items) == 0 {
+			audit.Record(event)
+			return
+		}
+		for _, item := range items {
+			event.Target = item.Target
+			event.Status = item.Status
+			event.Result = auditResult(item.Status)
+			audit.Record(event)
+		}
+	}
+}
+
+// auditResult returns the result of an event with the given status code
+func auditResult(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return models.AuditDenied
+	case status >= http.StatusBadRequest:
+		return models.AuditFailure
+	}
+	return models.AuditSuccess
+}
+
+// ubusTarget returns path and method of a ubus call, or of every call of a batch
+func ubusTarget(c *gin.Context) string {
+	var jsonUBusCall models.UBusCallJSON
+	if err := c.ShouldBindBodyWith(&jsonUBusCall, binding.JSON); err == nil && jsonUBusCall.Path != "" {
+		return jsonUBusCall.Path + " " + jsonUBusCall.Method
+	}
+
+	var jsonBatch models.UBusBatchJSON
+	if err := c.ShouldBindBodyWith(&jsonBatch, binding.JSON); err != nil {
+		return ""
+	}
+	calls := []string{}
+	for _, call := range jsonBatch {
+		calls = append(calls, call.Path+" "+call.Method)
+	}
+	return strings.Join(calls, ", ")
+}
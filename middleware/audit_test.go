@@ -0,0 +1,175 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/executor"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/ubus"
+)
+
+// auditEvents returns the events recorded inside the audit file
+func auditEvents(t *testing.T) []models.AuditEvent {
+	f, err := os.Open(configuration.Config.AuditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	events := []models.AuditEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestAuditUBusItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs.Init("nethsecurity_api_test")
+
+	// operator can call system methods only
+	dir := t.TempDir()
+	configuration.Config.AuditFile = filepath.Join(dir, "audit.log")
+	configuration.Config.AuditMaxSize = 10
+	configuration.Config.UBusPolicyFile = filepath.Join(dir, "ubus_policy.json")
+	configuration.Config.RolesFile = filepath.Join(dir, "roles.json")
+	configuration.Config.UBusBatchMaxCalls = 50
+	configuration.Config.UBusBatchParallelism = 4
+	roles := `{"roles": {"operator": {"ubus": [{"path": "system", "method": "*"}]}}, "users": {"alice": "operator"}}`
+	if err := os.WriteFile(configuration.Config.RolesFile, []byte(roles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := configuration.LoadRoles(); err != nil {
+		t.Fatal(err)
+	}
+	if err := configuration.LoadUBusPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	fake := executor.NewFake()
+	fake.OnCall("system", "info", `{"uptime": 10}`, nil)
+	fake.OnCall("system", "board", "", &ubus.StatusError{Code: ubus.StatusUnknownError})
+	previous := executor.Default
+	executor.Default = fake
+	defer func() { executor.Default = previous }()
+
+	login := func(c *gin.Context) {
+		c.Set("JWT_PAYLOAD", jwt.MapClaims{"id": "alice", "role": "operator"})
+	}
+	router := gin.New()
+	router.POST("/api/ubus/batch", login, AuditMiddleware(models.AuditUBus), methods.UBusBatchAction)
+	router.POST("/api/ubus/stream", login, AuditMiddleware(models.AuditUBus), methods.UBusStreamAction)
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		want   []models.AuditEvent
+	}{
+		{
+			name:   "batch",
+			path:   "/api/ubus/batch",
+			body:   `[{"path": "system", "method": "info"}, {"path": "system", "method": "board"}, {"path": "network.interface", "method": "dump"}]`,
+			status: http.StatusOK,
+			want: []models.AuditEvent{
+				{Target: "system info", Result: models.AuditSuccess, Status: http.StatusOK},
+				{Target: "system board", Result: models.AuditFailure, Status: http.StatusInternalServerError},
+				{Target: "network.interface dump", Result: models.AuditDenied, Status: http.StatusForbidden},
+			},
+		},
+		{
+			name:   "batch stopped on error",
+			path:   "/api/ubus/batch?stop_on_error=true",
+			body:   `[{"path": "system", "method": "board"}, {"path": "system", "method": "info"}]`,
+			status: http.StatusOK,
+			want: []models.AuditEvent{
+				{Target: "system board", Result: models.AuditFailure, Status: http.StatusInternalServerError},
+				{Target: "system info", Result: models.AuditFailure, Status: http.StatusFailedDependency},
+			},
+		},
+		{
+			// refused before running any call, recorded once
+			name:   "malformed batch",
+			path:   "/api/ubus/batch",
+			body:   `{`,
+			status: http.StatusBadRequest,
+			want: []models.AuditEvent{
+				{Result: models.AuditFailure, Status: http.StatusBadRequest},
+			},
+		},
+		{
+			name:   "stream success",
+			path:   "/api/ubus/stream",
+			body:   `{"path": "system", "method": "info"}`,
+			status: http.StatusOK,
+			want: []models.AuditEvent{
+				{Target: "system info", Result: models.AuditSuccess, Status: http.StatusOK},
+			},
+		},
+		{
+			// the stream starts with 200, its result is known only at the end
+			name:   "stream failure",
+			path:   "/api/ubus/stream",
+			body:   `{"path": "system", "method": "board"}`,
+			status: http.StatusOK,
+			want: []models.AuditEvent{
+				{Target: "system board", Result: models.AuditFailure, Status: http.StatusInternalServerError},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded := len(auditEvents(t))
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+
+			events := auditEvents(t)[recorded:]
+			got := []models.AuditEvent{}
+			for _, event := range events {
+				if event.Type != models.AuditUBus || event.User != "alice" || event.Path != strings.Split(tt.path, "?")[0] {
+					t.Errorf("event = %+v, want ubus event of alice on %s", event, tt.path)
+				}
+				got = append(got, models.AuditEvent{Target: event.Target, Result: event.Result, Status: event.Status})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("events = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+const responseControllerKey = "RESPONSE_CONTROLLER"
+
+// ResponseControllerMiddleware saves the controller of the connection, deadlines are set through it
+// because middlewares wrapping the writer, like gzip, hide the connection. It must run before them
+func ResponseControllerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(responseControllerKey, http.NewResponseController(c.Writer))
+		c.Next()
+	}
+}
+
+// DeadlineMiddleware extends the read and write deadlines of the server for a route with long responses.
+// The read deadline is extended too, because the server cancels the request context when it expires.
+// It must run after authentication, so that only authenticated clients get the longer limits
+func DeadlineMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		extendDeadline(c, timeout)
+		c.Next()
+	}
+}
+
+// BatchDeadlineMiddleware extends the deadlines like DeadlineMiddleware, adding perCall for every call
+// of the batch in the body. Batches too big or malformed get a single call, they are refused anyway
+func BatchDeadlineMiddleware(timeout time.Duration, perCall time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		calls := 1
+		var jsonBatch models.UBusBatchJSON
+		if err := c.ShouldBindBodyWith(&jsonBatch, binding.JSON); err == nil && len(jsonBatch) > 1 && len(jsonBatch) <= configuration.Config.UBusBatchMaxCalls {
+			calls = len(jsonBatch)
+		}
+
+		extendDeadline(c, timeout+time.Duration(calls)*perCall)
+		c.Next()
+	}
+}
+
+// extendDeadline sets the read and write deadlines of the connection of the request
+func extendDeadline(c *gin.Context, timeout time.Duration) {
+	controller, ok := c.Value(responseControllerKey).(*http.ResponseController)
+	if !ok {
+		controller = http.NewResponseController(c.Writer)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		logs.Logs.Println("[WARNING][SERVER] cannot extend read deadline of " + c.FullPath() + ": " + err.Error())
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		logs.Logs.Println("[WARNING][SERVER] cannot extend write deadline of " + c.FullPath() + ": " + err.Error())
+	}
+}
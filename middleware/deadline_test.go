@@ -0,0 +1,87 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+)
+
+func TestDeadlineMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs.Init("nethsecurity_api_test")
+
+	// responses take longer than the server timeouts
+	slow := func(c *gin.Context) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			c.String(http.StatusOK, "done")
+		case <-c.Request.Context().Done():
+		}
+	}
+	router := gin.New()
+	router.Use(ResponseControllerMiddleware())
+	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	router.GET("/extended", DeadlineMiddleware(time.Second), slow)
+	router.GET("/short", DeadlineMiddleware(10*time.Millisecond), slow)
+	router.POST("/batch", BatchDeadlineMiddleware(0, 100*time.Millisecond), slow)
+	router.GET("/default", slow)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	configuration.Config.UBusBatchMaxCalls = 50
+	call := `{"path": "system", "method": "info"}`
+
+	tests := []struct {
+		name     string
+		path     string
+		batch    string
+		complete bool
+	}{
+		{name: "extended", path: "/extended", complete: true},
+		{name: "short", path: "/short"},
+		{name: "default", path: "/default"},
+		{name: "batch of many calls", path: "/batch", batch: "[" + strings.Repeat(call+",", 5) + call + "]", complete: true},
+		{name: "batch of one call", path: "/batch", batch: "[" + call + "]"},
+		{name: "malformed batch", path: "/batch", batch: "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			complete := false
+			var res *http.Response
+			var err error
+			if tt.batch != "" {
+				res, err = client.Post(server.URL+tt.path, "application/json", strings.NewReader(tt.batch))
+			} else {
+				// compressed responses are extended too
+				res, err = client.Get(server.URL + tt.path)
+			}
+			if err == nil {
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				complete = res.StatusCode == http.StatusOK && string(body) == "done"
+			}
+			if complete != tt.complete {
+				t.Fatalf("got complete %v (%v), want %v", complete, err, tt.complete)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// LoginLockoutMiddleware refuses login attempts of locked users and clients before checking credentials
+func LoginLockoutMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// read username, missing values are reported by the login handler
+		var loginVals login
+		_ = c.ShouldBindBodyWith(&loginVals, binding.JSON)
+
+		if !methods.CheckAuthLockout(c, loginVals.Username) {
+			return
+		}
+		c.Next()
+	}
+}
@@ -12,19 +12,25 @@ package middleware
 import (
 	"bytes"
 	"io"
-	"regexp"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/fatih/structs"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 
 	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/google/uuid"
 
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/authenticator"
 	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/keyring"
 	"github.com/NethServer/nethsecurity-api/logs"
 	"github.com/NethServer/nethsecurity-api/methods"
 	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/redact"
 	"github.com/NethServer/nethsecurity-api/response"
 )
 
@@ -48,37 +54,57 @@ func InitJWT() *jwt.GinJWTMiddleware {
 	// define jwt middleware
 	authMiddleware, errDefine := jwt.New(&jwt.GinJWTMiddleware{
 		Realm:       "nethserver",
-		Key:         []byte(configuration.Config.SecretJWT),
+		KeyFunc:     keyring.KeyFunc,
 		Timeout:     time.Hour * 24, // 1 day
 		MaxRefresh:  time.Hour * 24, // 1 day
 		IdentityKey: identityKey,
 		Authenticator: func(c *gin.Context) (interface{}, error) {
 			// check login credentials exists
 			var loginVals login
-			if err := c.ShouldBind(&loginVals); err != nil {
+			if err := c.ShouldBindBodyWith(&loginVals, binding.JSON); err != nil {
 				return "", jwt.ErrMissingLoginValues
 			}
 
 			// set login credentials
 			username := loginVals.Username
 			password := loginVals.Password
+			audit.SetUser(c, username)
 
 			// check login
-			err := methods.CheckAuthentication(username, password)
+			identity, err := methods.CheckAuthentication(username, password)
 			if err != nil {
 				// login failed, write also the IP address of the client
 				logs.Logs.Println("[INFO][AUTH] authentication failed for user " + username + " from " + c.ClientIP() + ": " + err.Error())
+				methods.RegisterAuthFailure(username, c.ClientIP())
 
 				// return JWT error
 				return nil, jwt.ErrFailedAuthentication
 			}
 
+			// users of directories are named after their backend, e.g. ldap:alice
+			username = identity.Username
+			audit.SetUser(c, username)
+
+			// users of directories get the role mapped from their groups
+			role := ""
+			if identity.Backend != authenticator.BackendLocal {
+				role = configuration.GetGroupsRole(identity.Groups)
+				if role == "" {
+					logs.Logs.Println("[INFO][AUTH] login refused for " + identity.Backend + " user " + username + " from " + c.ClientIP() + ": no group mapped to a role")
+					return nil, jwt.ErrFailedAuthentication
+				}
+			} else {
+				methods.InitPasswordChanged(username)
+			}
+
 			// login ok action
-			logs.Logs.Println("[INFO][AUTH] authentication success for user " + username + " from " + c.ClientIP())
+			logs.Logs.Println("[INFO][AUTH] authentication success for " + identity.Backend + " user " + username + " from " + c.ClientIP())
 
 			// return user auth model
 			return &models.UserAuthorizations{
 				Username: username,
+				Role:     role,
+				Provider: authenticator.Provider(identity.Backend),
 			}, nil
 
 		},
@@ -88,22 +114,39 @@ func InitJWT() *jwt.GinJWTMiddleware {
 				// check if user require 2fa
 				status, _ := methods.GetUserStatus(user.Username)
 
-				if user.SudoRequested {
-					// create claims map
-					return jwt.MapClaims{
-						identityKey: user.Username,
-						"role":      "",
-						"actions":   []string{},
-						"2fa":       status == "1",
-						"sudo":      time.Now().Unix(),
-					}
+				// get role, the role of external identities is set by the login. Its actions are
+				// resolved at every request, refreshed tokens follow changes of the roles file
+				role := user.Role
+				if role == "" {
+					role = configuration.GetUserRole(user.Username)
 				}
-				return jwt.MapClaims{
+
+				// token id is kept by tokens issued for the same session
+				tokenID := user.TokenID
+				if tokenID == "" {
+					tokenID = uuid.New().String()
+				}
+
+				// create claims map
+				claims := jwt.MapClaims{
+					"jti":       tokenID,
 					identityKey: user.Username,
-					"role":      "",
-					"actions":   []string{},
+					"role":      role,
 					"2fa":       status == "1",
 				}
+				if user.SudoRequested {
+					claims["sudo"] = time.Now().Unix()
+				}
+				if user.SudoOTP {
+					claims["sudo_otp"] = time.Now().Unix()
+				}
+				// password expiry applies only to local users, identity providers manage their own
+				if user.Provider != "" {
+					claims["provider"] = user.Provider
+				} else if methods.PasswordChangeRequired(user.Username) {
+					claims["password_change"] = true
+				}
+				return claims
 			}
 
 			// return claims map
@@ -114,10 +157,13 @@ func InitJWT() *jwt.GinJWTMiddleware {
 			claims := jwt.ExtractClaims(c)
 
 			// create user object
+			role, _ := claims["role"].(string)
+			provider, _ := claims["provider"].(string)
 			user := &models.UserAuthorizations{
 				Username: claims[identityKey].(string),
-				Role:     "admin",
-				Actions:  nil,
+				Role:     role,
+				Provider: provider,
+				Actions:  methods.ClaimsActions(claims),
 			}
 
 			// return user
@@ -142,38 +188,7 @@ func InitJWT() *jwt.GinJWTMiddleware {
 			}
 
 			// extract body
-			reqBody := ""
-			// if reqURI contains /files path, just replace the body with a static string to avoid logging the file content
-			if strings.Contains(reqURI, "/files") {
-				reqBody = "<file>"
-			}
-			if reqBody != "<file>" && (reqMethod == "POST" || reqMethod == "PUT") {
-				// extract body
-				var buf bytes.Buffer
-				tee := io.TeeReader(c.Request.Body, &buf)
-				body, _ := io.ReadAll(tee)
-				c.Request.Body = io.NopCloser(&buf)
-
-				// get JSON string body
-				jsonB := string(body)
-
-				// remove all spaces
-				jsonB = strings.ReplaceAll(jsonB, " ", "")
-
-				// create regex for sensitive words
-				for _, s := range configuration.Config.SensitiveList {
-					// create regex
-					r1 := regexp.MustCompile(`"` + s + `":"(.*?)"`) // match "token|password|secret":"<sensitive>"
-					r2 := regexp.MustCompile(`"` + s + `","(.*?)"`) // match "token|password|secret","<sensitive>"
-
-					// apply regex
-					jsonB = r1.ReplaceAllString(jsonB, `"`+s+`":"XXX"`)
-					jsonB = r2.ReplaceAllString(jsonB, `"`+s+`":"XXX"`)
-				}
-
-				// compose req body
-				reqBody = jsonB
-			}
+			reqBody := requestBody(c)
 
 			logs.Logs.Println("[INFO][AUTH] authorization success for user " + claims["id"].(string) + ". " + reqMethod + " " + reqURI + " " + reqBody)
 
@@ -185,16 +200,45 @@ func InitJWT() *jwt.GinJWTMiddleware {
 			tokenObj, _ := InstanceJWT().ParseTokenString(token)
 			claims := jwt.ExtractClaimsFromToken(tokenObj)
 
-			// set token to valid, if not 2FA
-			if !claims["2fa"].(bool) {
-				methods.SetTokenValidation(claims["id"].(string), token)
+			// with 2FA the token is discarded, a challenge for the second factor is returned instead
+			if claims["2fa"].(bool) {
+				username := claims["id"].(string)
+				role, _ := claims["role"].(string)
+				provider, _ := claims["provider"].(string)
+				challenge, expire, err := methods.NewTwoFactorChallenge(models.UserAuthorizations{
+					Username: username,
+					Role:     role,
+					Provider: provider,
+				}, c.ClientIP(), c.Request.UserAgent())
+				if err != nil {
+					logs.Logs.Println("[ERR][2FA] cannot create challenge for user " + username + ": " + err.Error())
+					c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+						Code:    500,
+						Message: "2FA challenge error",
+						Data:    nil,
+					}))
+					return
+				}
+
+				// write logs
+				logs.Logs.Println("[INFO][AUTH] login response for user " + username + ", second factor required")
+
+				// return 200 OK
+				c.JSON(200, gin.H{"code": 200, "expire": expire, "two_factor_required": true, "challenge": challenge, "methods": methods.TwoFactorMethods(username)})
+				return
 			}
 
+			// reset failed attempts, with 2FA only once the second factor is verified
+			methods.RegisterAuthSuccess(claims["id"].(string))
+
+			// set token to valid
+			methods.SetTokenValidation(claims["id"].(string), token, c.ClientIP(), c.Request.UserAgent())
+
 			// write logs
 			logs.Logs.Println("[INFO][AUTH] login response success for user " + claims["id"].(string))
 
 			// return 200 OK
-			c.JSON(200, gin.H{"code": 200, "expire": t, "token": token})
+			c.JSON(200, gin.H{"code": 200, "expire": t, "two_factor_required": false, "token": token})
 		},
 		RefreshResponse: func(c *gin.Context, code int, token string, t time.Time) {
 			//get claims
@@ -202,7 +246,7 @@ func InitJWT() *jwt.GinJWTMiddleware {
 			claims := jwt.ExtractClaimsFromToken(tokenObj)
 
 			// set token to valid
-			methods.SetTokenValidation(claims["id"].(string), token)
+			methods.SetTokenValidation(claims["id"].(string), token, c.ClientIP(), c.Request.UserAgent())
 
 			// write logs
 			logs.Logs.Println("[INFO][AUTH] refresh response success for user " + claims["id"].(string))
@@ -217,6 +261,7 @@ func InitJWT() *jwt.GinJWTMiddleware {
 
 			// set token to invalid
 			methods.DelTokenValidation(claims["id"].(string), tokenObj.Raw)
+			audit.SetUser(c, claims["id"].(string))
 
 			// write logs
 			logs.Logs.Println("[INFO][AUTH] logout response success for user " + claims["id"].(string))
@@ -257,3 +302,27 @@ func InitJWT() *jwt.GinJWTMiddleware {
 	// return object
 	return authMiddleware
 }
+
+// requestBody returns the body of the request to be logged, with sensitive values masked
+func requestBody(c *gin.Context) string {
+	reqMethod := c.Request.Method
+	reqURI := c.Request.RequestURI
+
+	reqBody := ""
+	// if reqURI contains /files path, just replace the body with a static string to avoid logging the file content
+	if strings.Contains(reqURI, "/files") {
+		reqBody = "<file>"
+	}
+	if reqBody != "<file>" && (reqMethod == "POST" || reqMethod == "PUT") {
+		// extract body
+		var buf bytes.Buffer
+		tee := io.TeeReader(c.Request.Body, &buf)
+		body, _ := io.ReadAll(tee)
+		c.Request.Body = io.NopCloser(&buf)
+
+		// mask sensitive values
+		reqBody = redact.Body(body)
+	}
+
+	return reqBody
+}
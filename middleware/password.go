@@ -0,0 +1,41 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/utils"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+)
+
+// passwordChangeRoutes are the routes allowed to tokens that must change password
+var passwordChangeRoutes = []string{
+	"route:/api/sudo:POST",
+	"route:/api/refresh:GET",
+	"route:/api/account/password:POST",
+}
+
+// PasswordChangeMiddleware restricts tokens of users that must change password to the password change
+func PasswordChangeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		if claims["password_change"] == true && !utils.MatchAction(passwordChangeRoutes, "route", c.Request.URL.Path, c.Request.Method) {
+			logs.Logs.Println("[INFO][AUTH] password change required for user " + claims["id"].(string) + ". " + c.Request.Method + " " + c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+				Code:    403,
+				Message: "password change required",
+				Data:    nil,
+			}))
+			return
+		}
+		c.Next()
+	}
+}
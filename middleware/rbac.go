@@ -0,0 +1,63 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/NethServer/nethsecurity-api/utils"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// RoleRoutesMiddleware checks that the role of the user grants access to the requested route
+func RoleRoutesMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := jwt.ExtractClaims(c)
+		if !utils.MatchAction(methods.ClaimsActions(claims), "route", c.Request.URL.Path, c.Request.Method) {
+			logs.Logs.Println("[INFO][RBAC] route forbidden for user " + claims["id"].(string) + ". " + c.Request.Method + " " + c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+				Code:    403,
+				Message: "route forbidden for current role",
+				Data:    nil,
+			}))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RoleUbusCallsMiddleware checks that the role of the user grants the requested ubus path and method
+func RoleUbusCallsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var jsonUBusCall models.UBusCallJSON
+		if err := c.ShouldBindBodyWith(&jsonUBusCall, binding.JSON); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+				Code:    400,
+				Message: "request fields malformed",
+				Data:    err.Error(),
+			}))
+			return
+		}
+		claims := jwt.ExtractClaims(c)
+		if !utils.MatchAction(methods.ClaimsActions(claims), "ubus", jsonUBusCall.Path, jsonUBusCall.Method) {
+			logs.Logs.Println("[INFO][RBAC] ubus call forbidden for user " + claims["id"].(string) + ". " + jsonUBusCall.Path + " " + jsonUBusCall.Method)
+			c.AbortWithStatusJSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+				Code:    403,
+				Message: "ubus call forbidden for current role",
+				Data:    "method not allowed",
+			}))
+			return
+		}
+		c.Next()
+	}
+}
@@ -6,12 +6,14 @@ SPDX-License-Identifier: GPL-2.0-only
 package middleware
 
 import (
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/models"
 	"github.com/NethServer/nethsecurity-api/response"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/fatih/structs"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"time"
 )
 
 // SudoModeMiddleware is used by general API endpoints to check for superuser token
@@ -21,14 +23,23 @@ func SudoModeMiddleware() gin.HandlerFunc {
 	}
 }
 
-// SudoCheckToken checks if the `sudo` claim is present and less than 5 minutes ago
+// SudoCheckToken checks if the `sudo` claim is present and less than SUDO_MAX_AGE seconds ago
 func SudoCheckToken(c *gin.Context) {
+	SudoCheckRule(c, models.SudoRule{MaxAge: configuration.Config.SudoMaxAge})
+}
+
+// SudoCheckRule checks if the `sudo` claim satisfies the maximum age and OTP requirement of the rule
+func SudoCheckRule(c *gin.Context, rule models.SudoRule) {
 	// Get JWT claims
 	claims := jwt.ExtractClaims(c)
-	// Check if `sudo` was less than 5 minutes ago or `sudo` is not present
-	if claims["sudo"] == nil || time.Now().Unix()-int64(claims["sudo"].(float64)) > 300 {
+	// Check if `sudo` was enabled inside the rule window
+	if !methods.CheckSudoClaims(claims, rule.MaxAge, rule.RequireOTP) {
+		message := "sudo mode required"
+		if rule.RequireOTP && claims["2fa"] == true {
+			message = "sudo mode with otp required"
+		}
 		c.JSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
-			Message: "sudo mode required",
+			Message: message,
 		}))
 		c.Abort()
 		return
@@ -0,0 +1,112 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/keyring"
+	"github.com/NethServer/nethsecurity-api/logs"
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	jwtv4 "github.com/golang-jwt/jwt/v4"
+)
+
+// signToken sets expiry and issue time of the claims and signs them with the current key
+func signToken(claims jwtv4.MapClaims) (string, time.Time, error) {
+	mw := InstanceJWT()
+
+	expire := mw.TimeFunc().Add(mw.Timeout)
+	claims["exp"] = expire.Unix()
+	claims["orig_iat"] = mw.TimeFunc().Unix()
+
+	token, err := keyring.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expire, nil
+}
+
+// unauthorized replies like the JWT middleware does on errors
+func unauthorized(c *gin.Context, code int, message string) {
+	mw := InstanceJWT()
+
+	c.Header("WWW-Authenticate", "JWT realm="+mw.Realm)
+	c.Abort()
+	mw.Unauthorized(c, code, message)
+}
+
+// GenerateToken returns a token for the user, signed with the current key
+func GenerateToken(data interface{}) (string, time.Time, error) {
+	claims := jwtv4.MapClaims{}
+	for key, value := range InstanceJWT().PayloadFunc(data) {
+		claims[key] = value
+	}
+	return signToken(claims)
+}
+
+// LoginHandler checks credentials and returns a token signed with the current key
+func LoginHandler(c *gin.Context) {
+	mw := InstanceJWT()
+
+	data, err := mw.Authenticator(c)
+	if err != nil {
+		unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(err, c))
+		return
+	}
+
+	token, expire, err := GenerateToken(data)
+	if err != nil {
+		logs.Logs.Println("[ERR][JWT] token signing error: " + err.Error())
+		unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+
+	mw.LoginResponse(c, http.StatusOK, token, expire)
+}
+
+// RefreshHandler returns a new token for the current one, signed with the current key
+func RefreshHandler(c *gin.Context) {
+	mw := InstanceJWT()
+
+	claims, err := mw.CheckIfTokenExpire(c)
+	if err != nil {
+		unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(err, c))
+		return
+	}
+
+	// local users get the role currently assigned, a demoted user does not keep the old one
+	if _, ok := claims["provider"]; !ok {
+		claims["role"] = configuration.GetUserRole(claims[identityKey].(string))
+	}
+
+	token, expire, err := signToken(claims)
+	if err != nil {
+		logs.Logs.Println("[ERR][JWT] token signing error: " + err.Error())
+		unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+
+	mw.RefreshResponse(c, http.StatusOK, token, expire)
+}
+
+// RotateSigningKeys creates a new signing key when the current one is older than JWT_KEY_ROTATION,
+// previous keys are kept while their tokens can still be used or refreshed
+func RotateSigningKeys() {
+	mw := InstanceJWT()
+
+	maxAge := time.Duration(configuration.Config.JWTKeyRotation) * time.Second
+	if err := keyring.Rotate(maxAge, mw.Timeout+mw.MaxRefresh); err != nil {
+		logs.Logs.Println("[ERR][JWT] signing keys rotation error: " + err.Error())
+	}
+}
+
+// JWKS returns the public signing keys, to verify tokens issued by this server
+func JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, keyring.JWKS())
+}
@@ -0,0 +1,53 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorTokenHandler issues the session token once the previous handler has verified the second
+// factor of a pending login
+func TwoFactorTokenHandler(c *gin.Context) {
+	value, ok := c.Get(methods.TwoFactorVerifiedKey)
+	if !ok {
+		return
+	}
+	// the token keeps role and provider of the login, external identities do not get a local role
+	user := value.(*models.UserAuthorizations)
+	username := user.Username
+
+	// generate token
+	token, expire, err := GenerateToken(user)
+	if err != nil {
+		logs.Logs.Println("[ERR][2FA] cannot generate token for user " + username + ": " + err.Error())
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "token generation error",
+			Data:    nil,
+		}))
+		return
+	}
+
+	// reset failed attempts of password and second factor
+	methods.RegisterAuthSuccess(username)
+
+	// set token to valid
+	methods.SetTokenValidation(username, token, c.ClientIP(), c.Request.UserAgent())
+
+	// write logs
+	logs.Logs.Println("[INFO][AUTH] login response success for user " + username + " after 2FA")
+
+	// return 200 OK
+	c.JSON(200, gin.H{"code": 200, "expire": expire, "token": token})
+}
@@ -0,0 +1,27 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+import "time"
+
+type APIKey struct {
+	ID         string     `json:"id" structs:"id"`
+	Name       string     `json:"name" structs:"name"`
+	Hash       string     `json:"hash,omitempty" structs:"hash,omitempty"`
+	UBus       []UBusRule `json:"ubus" structs:"ubus"`
+	AllowedIPs []string   `json:"allowed_ips" structs:"allowed_ips"`
+	ExpiresAt  time.Time  `json:"expires_at" structs:"expires_at"`
+	CreatedBy  string     `json:"created_by" structs:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" structs:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" structs:"last_used_at"`
+}
+
+type APIKeyJSON struct {
+	Name       string     `json:"name" structs:"name" binding:"required"`
+	UBus       []UBusRule `json:"ubus" structs:"ubus" binding:"required,min=1"`
+	AllowedIPs []string   `json:"allowed_ips" structs:"allowed_ips"`
+	ExpiresAt  time.Time  `json:"expires_at" structs:"expires_at" binding:"required"`
+}
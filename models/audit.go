@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+import "time"
+
+// types of audit events
+const (
+	AuditLogin     = "login"
+	AuditLogout    = "logout"
+	AuditTwoFactor = "2fa"
+	AuditSudo      = "sudo"
+	AuditUBus      = "ubus"
+	AuditFile      = "file"
+	AuditPassword  = "password"
+	AuditAPIKey    = "api_key"
+	AuditSession   = "session"
+	AuditLockout   = "lockout"
+	AuditLogLevel  = "log_level"
+)
+
+// results of audit events
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"
+	AuditFailure = "failure"
+)
+
+type AuditEvent struct {
+	Time     time.Time `json:"time" structs:"time"`
+	Type     string    `json:"type" structs:"type"`
+	User     string    `json:"user" structs:"user"`
+	IP       string    `json:"ip" structs:"ip"`
+	Method   string    `json:"method" structs:"method"`
+	Path     string    `json:"path" structs:"path"`
+	Target   string    `json:"target,omitempty" structs:"target,omitempty"`
+	Result   string    `json:"result" structs:"result"`
+	Status   int       `json:"status" structs:"status"`
+	Duration int64     `json:"duration_ms" structs:"duration_ms"`
+}
+
+type AuditFilter struct {
+	Type    string
+	User    string
+	IP      string
+	Result  string
+	Since   time.Time
+	Until   time.Time
+	Page    int
+	PerPage int
+}
+
+type AuditPage struct {
+	Events  []AuditEvent `json:"events" structs:"events"`
+	Total   int          `json:"total" structs:"total"`
+	Page    int          `json:"page" structs:"page"`
+	PerPage int          `json:"per_page" structs:"per_page"`
+}
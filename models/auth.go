@@ -12,14 +12,24 @@ package models
 type UserAuthorizations struct {
 	Username      string   `json:"username" structs:"username"`
 	Role          string   `json:"role" structs:"role"`
+	Provider      string   `json:"provider" structs:"provider"`
 	Actions       []string `json:"actions" structs:"actions"`
 	SudoRequested bool     `json:"sudo_requested" structs:"sudo_requested"`
+	SudoOTP       bool     `json:"sudo_otp" structs:"sudo_otp"`
+	TokenID       string   `json:"token_id" structs:"token_id"`
+}
+
+type AuthIdentity struct {
+	Username string   `json:"username" structs:"username"`
+	Backend  string   `json:"backend" structs:"backend"`
+	Groups   []string `json:"groups" structs:"groups"`
 }
 
 type OTPJson struct {
-	Username string `json:"username" structs:"username"`
-	Token    string `json:"token" structs:"token"`
-	OTP      string `json:"otp" structs:"otp"`
+	Username  string `json:"username" structs:"username"`
+	Token     string `json:"token" structs:"token"`
+	Challenge string `json:"challenge" structs:"challenge"`
+	OTP       string `json:"otp" structs:"otp"`
 }
 
 type Status2FA struct {
@@ -0,0 +1,13 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+type ClientCert struct {
+	Subject string `json:"subject" structs:"subject"`
+	SAN     string `json:"san" structs:"san"`
+	User    string `json:"user" structs:"user"`
+	APIKey  string `json:"api_key" structs:"api_key"`
+}
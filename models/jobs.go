@@ -0,0 +1,27 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+import "time"
+
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+type Job struct {
+	ID         string                 `json:"id" structs:"id"`
+	Owner      string                 `json:"owner" structs:"owner"`
+	Path       string                 `json:"path" structs:"path"`
+	Method     string                 `json:"method" structs:"method"`
+	State      string                 `json:"state" structs:"state"`
+	ExitCode   int                    `json:"exit_code" structs:"exit_code"`
+	Output     map[string]interface{} `json:"output" structs:"output"`
+	CreatedAt  time.Time              `json:"created_at" structs:"created_at"`
+	FinishedAt *time.Time             `json:"finished_at" structs:"finished_at"`
+}
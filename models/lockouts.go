@@ -0,0 +1,16 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+import "time"
+
+type Lockout struct {
+	Username    string    `json:"username,omitempty" structs:"username"`
+	IP          string    `json:"ip,omitempty" structs:"ip"`
+	Failures    int       `json:"failures" structs:"failures"`
+	LastFailure time.Time `json:"last_failure" structs:"last_failure"`
+	LockedUntil time.Time `json:"locked_until" structs:"locked_until"`
+}
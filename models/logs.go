@@ -0,0 +1,10 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+type LogLevelJSON struct {
+	Level string `json:"level" structs:"level" binding:"required"`
+}
@@ -0,0 +1,45 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+type UBusRule struct {
+	Path   string `json:"path" structs:"path"`
+	Method string `json:"method" structs:"method"`
+}
+
+type RouteRule struct {
+	Method string `json:"method" structs:"method"`
+	Path   string `json:"path" structs:"path"`
+}
+
+type Role struct {
+	UBus   []UBusRule  `json:"ubus" structs:"ubus"`
+	Routes []RouteRule `json:"routes" structs:"routes"`
+}
+
+type GroupRole struct {
+	Group string `json:"group" structs:"group"`
+	Role  string `json:"role" structs:"role"`
+}
+
+type RolesConfig struct {
+	DefaultRole string            `json:"default_role" structs:"default_role"`
+	Roles       map[string]Role   `json:"roles" structs:"roles"`
+	Users       map[string]string `json:"users" structs:"users"`
+	Groups      []GroupRole       `json:"groups" structs:"groups"`
+}
+
+type UBusPolicy struct {
+	Allow []UBusRule `json:"allow" structs:"allow"`
+	Deny  []UBusRule `json:"deny" structs:"deny"`
+}
+
+type SudoRule struct {
+	Path       string `json:"path" structs:"path"`
+	Method     string `json:"method" structs:"method"`
+	MaxAge     int64  `json:"max_age" structs:"max_age"`
+	RequireOTP bool   `json:"require_otp" structs:"require_otp"`
+}
@@ -0,0 +1,12 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+type RedactionRule struct {
+	Path   string   `json:"path" structs:"path"`
+	Method string   `json:"method" structs:"method"`
+	Keys   []string `json:"keys" structs:"keys"`
+}
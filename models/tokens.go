@@ -0,0 +1,29 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+import "time"
+
+type TokenRecord struct {
+	ID        string    `json:"id" structs:"id"`
+	Username  string    `json:"username" structs:"username"`
+	IssuedAt  time.Time `json:"issued_at" structs:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at" structs:"expires_at"`
+	ClientIP  string    `json:"client_ip" structs:"client_ip"`
+	UserAgent string    `json:"user_agent" structs:"user_agent"`
+	SudoAt    time.Time `json:"sudo_at" structs:"sudo_at"`
+}
+
+type Session struct {
+	ID        string    `json:"id" structs:"id"`
+	Username  string    `json:"username" structs:"username"`
+	IssuedAt  time.Time `json:"issued_at" structs:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at" structs:"expires_at"`
+	ClientIP  string    `json:"client_ip" structs:"client_ip"`
+	UserAgent string    `json:"user_agent" structs:"user_agent"`
+	Sudo      bool      `json:"sudo" structs:"sudo"`
+	Current   bool      `json:"current" structs:"current"`
+}
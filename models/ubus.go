@@ -14,3 +14,5 @@ type UBusCallJSON struct {
 	Method  string      `json:"method" structs:"method"`
 	Payload interface{} `json:"payload" structs:"payload"`
 }
+
+type UBusBatchJSON []UBusCallJSON
@@ -0,0 +1,40 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+type WebAuthnCredential struct {
+	ID         string              `json:"id" structs:"id"`
+	Name       string              `json:"name" structs:"name"`
+	CreatedAt  time.Time           `json:"created_at" structs:"created_at"`
+	LastUsedAt *time.Time          `json:"last_used_at" structs:"last_used_at"`
+	Credential webauthn.Credential `json:"credential" structs:"credential"`
+}
+
+type WebAuthnCredentials struct {
+	UserID      []byte               `json:"user_id" structs:"user_id"`
+	Credentials []WebAuthnCredential `json:"credentials" structs:"credentials"`
+}
+
+type WebAuthnRegisterJSON struct {
+	Name       string          `json:"name" structs:"name" binding:"required"`
+	Credential json.RawMessage `json:"credential" structs:"credential" binding:"required"`
+}
+
+type WebAuthnLoginJSON struct {
+	Challenge  string          `json:"challenge" structs:"challenge" binding:"required"`
+	Credential json.RawMessage `json:"credential" structs:"credential"`
+}
+
+type WebAuthnRenameJSON struct {
+	Name string `json:"name" structs:"name" binding:"required"`
+}
@@ -0,0 +1,333 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+
+	"github.com/NethServer/nethsecurity-api/audit"
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/methods"
+	"github.com/NethServer/nethsecurity-api/middleware"
+	"github.com/NethServer/nethsecurity-api/models"
+	"github.com/NethServer/nethsecurity-api/response"
+)
+
+// ProviderName is set in the provider claim of tokens issued to OIDC users
+const ProviderName = "oidc"
+
+// usernamePrefix keeps OIDC users apart from local and directory users with the same name
+const usernamePrefix = ProviderName + ":"
+
+// validUsername matches the values of the username claim that are accepted
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9._@+|-]{1,255}$`)
+
+// stateCookie binds a pending login to the browser that started it
+const stateCookie = "oidc_state"
+
+// loginTimeout is the time the user has to authenticate on the IdP
+const loginTimeout = 10 * time.Minute
+
+// pendingLogin holds the secrets of a login redirected to the IdP, by state
+type pendingLogin struct {
+	Verifier  string
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+var pendingLogins = map[string]*pendingLogin{}
+var pendingLoginsLock sync.Mutex
+
+var provider *gooidc.Provider
+var providerIssuer string
+var providerLock sync.Mutex
+
+// providerTimeout limits discovery and key set requests to the IdP
+const providerTimeout = 10 * time.Second
+
+// getProvider runs the discovery of the IdP on first use, so the server starts even if it is unreachable.
+// The provider outlives the request, it keeps its context to fetch the IdP keys
+func getProvider() (*gooidc.Provider, error) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+
+	if provider != nil && providerIssuer == configuration.Config.OIDCIssuer {
+		return provider, nil
+	}
+	ctx := gooidc.ClientContext(context.Background(), &http.Client{Timeout: providerTimeout})
+	discovered, err := gooidc.NewProvider(ctx, configuration.Config.OIDCIssuer)
+	if err != nil {
+		return nil, err
+	}
+	provider = discovered
+	providerIssuer = configuration.Config.OIDCIssuer
+	return provider, nil
+}
+
+// oauth2Config returns the client configuration for the IdP endpoints
+func oauth2Config(p *gooidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     configuration.Config.OIDCClientID,
+		ClientSecret: configuration.Config.OIDCClientSecret,
+		RedirectURL:  configuration.Config.OIDCRedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       configuration.Config.OIDCScopes,
+	}
+}
+
+// randomString returns a hex encoded random value
+func randomString() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// secureRequest tells if the client reached the server over HTTPS, directly or through a proxy
+func secureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// groupsFromClaims reads the groups claim, a list of strings or a single string
+func groupsFromClaims(claims map[string]interface{}) []string {
+	groups := []string{}
+	switch value := claims[configuration.Config.OIDCGroupsClaim].(type) {
+	case []interface{}:
+		for _, group := range value {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+	case string:
+		groups = append(groups, value)
+	}
+	return groups
+}
+
+// postLoginURL returns OIDC_POST_LOGIN_URL with the values in the fragment, never sent to servers,
+// appended to the route of UIs using hash routing
+func postLoginURL(values url.Values) string {
+	target := configuration.Config.OIDCPostLoginURL
+
+	separator := "#"
+	if index := strings.Index(target, "#"); index >= 0 {
+		separator = "?"
+		if strings.Contains(target[index:], "?") {
+			separator = "&"
+		}
+	}
+	return target + separator + values.Encode()
+}
+
+// fail ends a login, redirecting to the UI when OIDC_POST_LOGIN_URL is set
+func fail(c *gin.Context, code int, message string, data interface{}) {
+	audit.SetStatus(c, code)
+	if configuration.Config.OIDCPostLoginURL != "" {
+		c.Redirect(http.StatusFound, postLoginURL(url.Values{"error": {message}}))
+		return
+	}
+	c.JSON(code, gin.H{"code": code, "message": message, "data": data})
+}
+
+// Login redirects the browser to the IdP authorization endpoint, using PKCE
+func Login(c *gin.Context) {
+	// check configuration
+	if configuration.Config.OIDCIssuer == "" {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "oidc not configured",
+			Data:    nil,
+		}))
+		return
+	}
+
+	// discover IdP endpoints
+	p, err := getProvider()
+	if err != nil {
+		logs.Logs.Println("[ERR][OIDC] discovery of " + configuration.Config.OIDCIssuer + " failed: " + err.Error())
+		c.JSON(http.StatusServiceUnavailable, structs.Map(response.StatusServiceUnavailable{
+			Code:    503,
+			Message: "oidc provider unreachable",
+			Data:    err.Error(),
+		}))
+		return
+	}
+
+	// generate state, nonce and code verifier
+	state, err := randomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "oidc login error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
+			Code:    500,
+			Message: "oidc login error",
+			Data:    err.Error(),
+		}))
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	pendingLoginsLock.Lock()
+	// remove expired logins
+	now := time.Now()
+	for key, pending := range pendingLogins {
+		if pending.ExpiresAt.Before(now) {
+			delete(pendingLogins, key)
+		}
+	}
+	pendingLogins[state] = &pendingLogin{
+		Verifier:  verifier,
+		Nonce:     nonce,
+		ExpiresAt: now.Add(loginTimeout),
+	}
+	pendingLoginsLock.Unlock()
+
+	// bind state to the browser and redirect to IdP
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, state, int(loginTimeout.Seconds()), "/api/oidc", "", secureRequest(c), true)
+	c.Redirect(http.StatusFound, oauth2Config(p).AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+}
+
+// Callback exchanges the authorization code, verifies the ID token and issues a session token with
+// the role mapped from the IdP groups
+func Callback(c *gin.Context) {
+	// check configuration
+	if configuration.Config.OIDCIssuer == "" {
+		c.JSON(http.StatusNotFound, structs.Map(response.StatusNotFound{
+			Code:    404,
+			Message: "oidc not configured",
+			Data:    nil,
+		}))
+		return
+	}
+
+	// errors reported by IdP, e.g. login cancelled by the user
+	if c.Query("error") != "" {
+		logs.Logs.Println("[INFO][OIDC] login refused by provider: " + c.Query("error") + " " + c.Query("error_description"))
+		fail(c, http.StatusUnauthorized, "oidc login refused", c.Query("error"))
+		return
+	}
+
+	// get pending login, it can be used once and only by the browser that started it
+	state := c.Query("state")
+	pendingLoginsLock.Lock()
+	pending, ok := pendingLogins[state]
+	delete(pendingLogins, state)
+	pendingLoginsLock.Unlock()
+
+	cookie, _ := c.Cookie(stateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, "", -1, "/api/oidc", "", secureRequest(c), true)
+	if !ok || pending.ExpiresAt.Before(time.Now()) || cookie != state {
+		fail(c, http.StatusBadRequest, "oidc state invalid", nil)
+		return
+	}
+
+	// exchange code for tokens
+	p, err := getProvider()
+	if err != nil {
+		logs.Logs.Println("[ERR][OIDC] discovery of " + configuration.Config.OIDCIssuer + " failed: " + err.Error())
+		fail(c, http.StatusServiceUnavailable, "oidc provider unreachable", err.Error())
+		return
+	}
+	oauth2Token, err := oauth2Config(p).Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(pending.Verifier))
+	if err != nil {
+		logs.Logs.Println("[ERR][OIDC] code exchange failed: " + err.Error())
+		fail(c, http.StatusUnauthorized, "oidc code exchange failed", err.Error())
+		return
+	}
+
+	// verify ID token signature, issuer, audience, expiry and nonce
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok {
+		fail(c, http.StatusUnauthorized, "oidc id token missing", nil)
+		return
+	}
+	idToken, err := p.Verifier(&gooidc.Config{ClientID: configuration.Config.OIDCClientID}).Verify(c.Request.Context(), rawIDToken)
+	if err != nil {
+		logs.Logs.Println("[ERR][OIDC] id token verification failed: " + err.Error())
+		fail(c, http.StatusUnauthorized, "oidc id token invalid", err.Error())
+		return
+	}
+	if idToken.Nonce != pending.Nonce {
+		fail(c, http.StatusUnauthorized, "oidc id token invalid", "nonce mismatch")
+		return
+	}
+
+	// read username and groups
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		fail(c, http.StatusUnauthorized, "oidc id token invalid", err.Error())
+		return
+	}
+	subject, _ := claims[configuration.Config.OIDCUsernameClaim].(string)
+	if subject == "" {
+		fail(c, http.StatusUnauthorized, "oidc username missing", configuration.Config.OIDCUsernameClaim)
+		return
+	}
+	if !validUsername.MatchString(subject) {
+		logs.Logs.Println("[INFO][OIDC] login refused: invalid characters in claim " + configuration.Config.OIDCUsernameClaim)
+		fail(c, http.StatusUnauthorized, "oidc username invalid", configuration.Config.OIDCUsernameClaim)
+		return
+	}
+	username := usernamePrefix + subject
+	audit.SetUser(c, username)
+
+	// map groups to role, users without a mapped group are refused
+	role := configuration.GetGroupsRole(groupsFromClaims(claims))
+	if role == "" {
+		logs.Logs.Println("[INFO][OIDC] login refused for user " + username + ": no group mapped to a role")
+		fail(c, http.StatusForbidden, "oidc user not allowed", nil)
+		return
+	}
+
+	// issue the same token of local logins
+	token, expire, err := middleware.GenerateToken(&models.UserAuthorizations{
+		Username: username,
+		Role:     role,
+		Provider: ProviderName,
+	})
+	if err != nil {
+		logs.Logs.Println("[ERR][OIDC] token signing error: " + err.Error())
+		fail(c, http.StatusInternalServerError, "Impossible to generate token", nil)
+		return
+	}
+	methods.SetTokenValidation(username, token, c.ClientIP(), c.Request.UserAgent())
+
+	logs.Logs.Println("[INFO][OIDC] login success for user " + username + " with role " + role + " from " + c.ClientIP())
+
+	// hand the token to the UI, or return it like the login API
+	if configuration.Config.OIDCPostLoginURL != "" {
+		c.Redirect(http.StatusFound, postLoginURL(url.Values{
+			"token":  {token},
+			"expire": {expire.Format(time.RFC3339)},
+		}))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "expire": expire, "two_factor_required": false, "token": token})
+}
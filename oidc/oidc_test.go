@@ -0,0 +1,308 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwtv4 "github.com/golang-jwt/jwt/v4"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/keyring"
+	"github.com/NethServer/nethsecurity-api/logs"
+	"github.com/NethServer/nethsecurity-api/store"
+)
+
+const testClientID = "nethsecurity"
+const testCode = "test-code"
+
+// mockIdP is an identity provider issuing ID tokens for a single authorization code
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// values of the authorization request, set by the test
+	challenge string
+	nonce     string
+
+	// claims of the next ID token
+	claims jwtv4.MapClaims
+}
+
+func newMockIdP() *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		// check code and PKCE verifier against the challenge of the authorization request
+		hash := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != testCode || base64.RawURLEncoding.EncodeToString(hash[:]) != idp.challenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwtv4.MapClaims{
+			"iss":   idp.server.URL,
+			"aud":   testClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": idp.nonce,
+		}
+		for name, value := range idp.claims {
+			claims[name] = value
+		}
+		token := jwtv4.NewWithClaims(jwtv4.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+var idp *mockIdP
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logs.Init("nethsecurity_api_test")
+
+	dir, err := os.MkdirTemp("", "nethsecurity-api-test")
+	if err != nil {
+		panic(err)
+	}
+	configuration.Config.SecretsDir = filepath.Join(dir, "secrets")
+	configuration.Config.JWTKeysDir = filepath.Join(dir, "jwt_keys")
+	configuration.Config.JWTSigningAlg = "HS256"
+	if err := keyring.Init(); err != nil {
+		panic(err)
+	}
+	if store.Tokens, err = store.OpenBoltTokenStore(filepath.Join(dir, "tokens.db")); err != nil {
+		panic(err)
+	}
+
+	// map IdP groups to roles
+	configuration.Config.RolesFile = filepath.Join(dir, "roles.json")
+	roles := `{"roles": {"auditor": {}}, "groups": [{"group": "fw-admins", "role": "admin"}, {"group": "auditors", "role": "auditor"}]}`
+	if err := os.WriteFile(configuration.Config.RolesFile, []byte(roles), 0600); err != nil {
+		panic(err)
+	}
+	if err := configuration.LoadRoles(); err != nil {
+		panic(err)
+	}
+
+	idp = newMockIdP()
+	configuration.Config.OIDCIssuer = idp.server.URL
+	configuration.Config.OIDCClientID = testClientID
+	configuration.Config.OIDCClientSecret = "secret"
+	configuration.Config.OIDCRedirectURL = "https://fw.example.org/api/oidc/callback"
+	configuration.Config.OIDCScopes = []string{"openid"}
+	configuration.Config.OIDCUsernameClaim = "sub"
+	configuration.Config.OIDCGroupsClaim = "groups"
+
+	code := m.Run()
+	idp.server.Close()
+	store.Tokens.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  jwtv4.MapClaims
+		tamper  func(state string, cookie *http.Cookie)
+		code    int
+		message string
+		user    string
+		role    string
+	}{
+		{
+			name:   "success",
+			claims: jwtv4.MapClaims{"sub": "248289761001", "groups": []string{"fw-admins"}},
+			code:   http.StatusOK,
+			user:   "oidc:248289761001",
+			role:   "admin",
+		},
+		{
+			name:   "first mapped group",
+			claims: jwtv4.MapClaims{"sub": "alice", "groups": []string{"staff", "auditors"}},
+			code:   http.StatusOK,
+			user:   "oidc:alice",
+			role:   "auditor",
+		},
+		{
+			name:   "single group",
+			claims: jwtv4.MapClaims{"sub": "alice", "groups": "auditors"},
+			code:   http.StatusOK,
+			user:   "oidc:alice",
+			role:   "auditor",
+		},
+		{
+			name:    "no mapped group",
+			claims:  jwtv4.MapClaims{"sub": "alice", "groups": []string{"staff"}},
+			code:    http.StatusForbidden,
+			message: "oidc user not allowed",
+		},
+		{
+			name:    "invalid username",
+			claims:  jwtv4.MapClaims{"sub": "../jwt_keys", "groups": []string{"fw-admins"}},
+			code:    http.StatusUnauthorized,
+			message: "oidc username invalid",
+		},
+		{
+			name:    "missing username",
+			claims:  jwtv4.MapClaims{"groups": []string{"fw-admins"}},
+			code:    http.StatusUnauthorized,
+			message: "oidc username missing",
+		},
+		{
+			name:   "state of other browser",
+			claims: jwtv4.MapClaims{"sub": "alice", "groups": []string{"fw-admins"}},
+			tamper: func(state string, cookie *http.Cookie) {
+				cookie.Value = "other"
+			},
+			code:    http.StatusBadRequest,
+			message: "oidc state invalid",
+		},
+		{
+			name:   "nonce mismatch",
+			claims: jwtv4.MapClaims{"sub": "alice", "groups": []string{"fw-admins"}},
+			tamper: func(state string, cookie *http.Cookie) {
+				idp.nonce = "other"
+			},
+			code:    http.StatusUnauthorized,
+			message: "oidc id token invalid",
+		},
+		{
+			name:   "pkce mismatch",
+			claims: jwtv4.MapClaims{"sub": "alice", "groups": []string{"fw-admins"}},
+			tamper: func(state string, cookie *http.Cookie) {
+				pendingLoginsLock.Lock()
+				pendingLogins[state].Verifier = "other"
+				pendingLoginsLock.Unlock()
+			},
+			code:    http.StatusUnauthorized,
+			message: "oidc code exchange failed",
+		},
+	}
+
+	router := gin.New()
+	router.GET("/api/oidc/login", Login)
+	router.GET("/api/oidc/callback", Callback)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// start login, the IdP receives nonce and PKCE challenge of the redirect
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+			if recorder.Code != http.StatusFound {
+				t.Fatalf("login: got %d %s", recorder.Code, recorder.Body.String())
+			}
+			location, err := url.Parse(recorder.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := location.Query().Get("state")
+			idp.challenge = location.Query().Get("code_challenge")
+			idp.nonce = location.Query().Get("nonce")
+			idp.claims = tt.claims
+			if location.Query().Get("code_challenge_method") != "S256" {
+				t.Fatalf("login: PKCE not used: %s", location)
+			}
+
+			cookies := recorder.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != stateCookie || cookies[0].Value != state {
+				t.Fatalf("login: state cookie not set: %v", cookies)
+			}
+			if tt.tamper != nil {
+				tt.tamper(state, cookies[0])
+			}
+
+			// return from IdP
+			request := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+url.Values{"state": {state}, "code": {testCode}}.Encode(), nil)
+			request.AddCookie(cookies[0])
+			recorder = httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			body := map[string]interface{}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON body %q: %v", recorder.Body.String(), err)
+			}
+			if recorder.Code != tt.code {
+				t.Fatalf("got %d %v, want %d", recorder.Code, body, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				if body["message"] != tt.message {
+					t.Fatalf("got message %v, want %q", body["message"], tt.message)
+				}
+				return
+			}
+
+			// the session token carries the namespaced user and the mapped role
+			tokenString, _ := body["token"].(string)
+			claims := jwtv4.MapClaims{}
+			if _, _, err := jwtv4.NewParser().ParseUnverified(tokenString, claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims["id"] != tt.user || claims["role"] != tt.role || claims["provider"] != ProviderName {
+				t.Fatalf("got claims %v, want user %s and role %s", claims, tt.user, tt.role)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+)
+
+// Mask replaces the values of sensitive keys
+const Mask = "XXX"
+
+// Body returns the JSON body to be logged, with the values of sensitive keys masked at any depth.
+// Bodies that are not valid JSON are replaced by their size, they cannot be masked safely
+func Body(body []byte) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	// parse body, numbers are kept as written
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return invalid(body)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return invalid(body)
+	}
+
+	// encode masked body, without escaping HTML characters
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redact(value, configuration.SensitiveKeys("", ""))); err != nil {
+		return invalid(body)
+	}
+	return string(bytes.TrimSuffix(out.Bytes(), []byte("\n")))
+}
+
+// invalid describes a body that is not valid JSON
+func invalid(body []byte) string {
+	return "<invalid JSON, " + strconv.Itoa(len(body)) + " bytes>"
+}
+
+// sensitive tells if the key matches one of the patterns
+func sensitive(key string, keys []*regexp.Regexp) bool {
+	for _, pattern := range keys {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact masks the values of sensitive keys inside objects and arrays. Objects with a path are ubus
+// calls, e.g. of /api/ubus/call and of every call of /api/ubus/batch, their payload is masked with
+// the extra keys of the redaction rules of path and method
+func redact(value interface{}, keys []*regexp.Regexp) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		payloadKeys := keys
+		if path, ok := v["path"].(string); ok {
+			method, _ := v["method"].(string)
+			payloadKeys = configuration.SensitiveKeys(path, method)
+		}
+		for key, item := range v {
+			switch {
+			case sensitive(key, keys):
+				v[key] = Mask
+			case key == "payload":
+				v[key] = redact(item, payloadKeys)
+			default:
+				v[key] = redact(item, keys)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item, keys)
+		}
+	}
+	return value
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package redact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "nethsecurity-api-test")
+	if err != nil {
+		panic(err)
+	}
+
+	// passwords are masked only in the payload of the calls changing users
+	configuration.Config.SensitiveList = []string{"*secret*", "*token*", "?in", " /^(api_)?key$/ ", ""}
+	configuration.Config.RedactionRulesFile = filepath.Join(dir, "redaction_rules.json")
+	rules := `[{"path": "ns.users", "method": "add-user|edit-user", "keys": ["password"]}, {"path": "ns\\.ipsec.*", "keys": ["/^psk$/"]}]`
+	if err := os.WriteFile(configuration.Config.RedactionRulesFile, []byte(rules), 0600); err != nil {
+		panic(err)
+	}
+	if err := configuration.LoadRedactionRules(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "empty",
+			body: " \n",
+			want: "",
+		},
+		{
+			name: "flat object",
+			body: `{"username": "root", "token": "abc"}`,
+			want: `{"token":"XXX","username":"root"}`,
+		},
+		{
+			name: "nested objects",
+			body: `{"a": {"b": {"client_secret": "s", "c": 1}}}`,
+			want: `{"a":{"b":{"c":1,"client_secret":"XXX"}}}`,
+		},
+		{
+			// values of any type are masked, including objects
+			name: "sensitive object",
+			body: `{"secrets": {"a": "b"}, "tokens": ["t1", "t2"]}`,
+			want: `{"secrets":"XXX","tokens":"XXX"}`,
+		},
+		{
+			name: "arrays",
+			body: `[{"token": "t"}, {"list": [{"secret": "s"}, "token", 1]}]`,
+			want: `[{"token":"XXX"},{"list":[{"secret":"XXX"},"token",1]}]`,
+		},
+		{
+			// numbers are kept as written
+			name: "numbers",
+			body: `{"secret": 123456789012345678901234567890, "ratio": 1.50, "exp": 1e3, "neg": -0}`,
+			want: `{"exp":1e3,"neg":-0,"ratio":1.50,"secret":"XXX"}`,
+		},
+		{
+			name: "escaped quotes",
+			body: `{"token": "a\"b\\", "note": "say \"token\": \"x\""}`,
+			want: `{"note":"say \"token\": \"x\"","token":"XXX"}`,
+		},
+		{
+			name: "values with spaces",
+			body: `{"name": "John Smith", "secret": "my secret value"}`,
+			want: `{"name":"John Smith","secret":"XXX"}`,
+		},
+		{
+			name: "html characters",
+			body: `{"url": "https://fw/?a=1&b=<2>"}`,
+			want: `{"url":"https://fw/?a=1&b=<2>"}`,
+		},
+		{
+			name: "case insensitive glob",
+			body: `{"Access_Token": "a", "CLIENT_SECRET": "b", "PIN": "1234", "tin": "c", "spin": "d", "in": "e"}`,
+			want: `{"Access_Token":"XXX","CLIENT_SECRET":"XXX","PIN":"XXX","in":"e","spin":"d","tin":"XXX"}`,
+		},
+		{
+			// regular expressions are case sensitive, unless they say otherwise
+			name: "regex key",
+			body: `{"key": "a", "api_key": "b", "monkey": "c", "API_KEY": "d", "keys": "e"}`,
+			want: `{"API_KEY":"d","api_key":"XXX","key":"XXX","keys":"e","monkey":"c"}`,
+		},
+		{
+			name: "invalid JSON",
+			body: `{"token": "abc"`,
+			want: "<invalid JSON, 15 bytes>",
+		},
+		{
+			name: "trailing data",
+			body: `{"token": "abc"} {"token": "def"}`,
+			want: "<invalid JSON, 33 bytes>",
+		},
+		{
+			name: "not JSON",
+			body: `token=abc&secret=def`,
+			want: "<invalid JSON, 20 bytes>",
+		},
+		{
+			name: "rule of the call",
+			body: `{"path": "ns.users", "method": "add-user", "payload": {"username": "alice", "password": "p", "profile": {"password": "q"}}}`,
+			want: `{"method":"add-user","path":"ns.users","payload":{"password":"XXX","profile":{"password":"XXX"},"username":"alice"}}`,
+		},
+		{
+			// rule keys are masked only inside the payload
+			name: "rule outside payload",
+			body: `{"path": "ns.users", "method": "add-user", "password": "p", "payload": {}}`,
+			want: `{"method":"add-user","password":"p","path":"ns.users","payload":{}}`,
+		},
+		{
+			name: "rule of other method",
+			body: `{"path": "ns.users", "method": "list-users", "payload": {"password": "p", "token": "t"}}`,
+			want: `{"method":"list-users","path":"ns.users","payload":{"password":"p","token":"XXX"}}`,
+		},
+		{
+			// path and method must match the whole value
+			name: "rule of other path",
+			body: `{"path": "ns.users.extra", "method": "add-user", "payload": {"password": "p"}}`,
+			want: `{"method":"add-user","path":"ns.users.extra","payload":{"password":"p"}}`,
+		},
+		{
+			name: "rule without method",
+			body: `{"path": "ns.ipsectunnel", "method": "add-tunnel", "payload": {"psk": "k", "PSK": "K"}}`,
+			want: `{"method":"add-tunnel","path":"ns.ipsectunnel","payload":{"PSK":"K","psk":"XXX"}}`,
+		},
+		{
+			name: "rules inside batch",
+			body: `[
+				{"path": "ns.users", "method": "add-user", "payload": {"username": "alice", "password": "p"}},
+				{"path": "ns.users", "method": "edit-user", "payload": {"users": [{"password": "q"}]}},
+				{"path": "ns.dhcp", "method": "add-user", "payload": {"password": "r", "api_key": "k"}},
+				{"path": "ns.users", "method": "list-users", "payload": {"password": "s"}}
+			]`,
+			want: `[{"method":"add-user","path":"ns.users","payload":{"password":"XXX","username":"alice"}},` +
+				`{"method":"edit-user","path":"ns.users","payload":{"users":[{"password":"XXX"}]}},` +
+				`{"method":"add-user","path":"ns.dhcp","payload":{"api_key":"XXX","password":"r"}},` +
+				`{"method":"list-users","path":"ns.users","payload":{"password":"s"}}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Body([]byte(tt.body)); got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
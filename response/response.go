@@ -62,6 +62,12 @@ type StatusConflict struct {
 	Data    interface{} `json:"data" structs:"data"`
 }
 
+type StatusFailedDependency struct {
+	Code    int         `json:"code" example:"424" structs:"code"`
+	Message string      `json:"message" example:"Failed dependency" structs:"message"`
+	Data    interface{} `json:"data" structs:"data"`
+}
+
 type StatusInternalServerError struct {
 	Code    int         `json:"code" example:"500" structs:"code"`
 	Message string      `json:"message" example:"Internal server error" structs:"message"`
@@ -73,3 +79,9 @@ type StatusServiceUnavailable struct {
 	Message string      `json:"message" example:"Service unavailable" structs:"message"`
 	Data    interface{} `json:"data" structs:"data"`
 }
+
+type StatusTooManyRequests struct {
+	Code    int         `json:"code" example:"429" structs:"code"`
+	Message string      `json:"message" example:"Too many requests" structs:"message"`
+	Data    interface{} `json:"data" structs:"data"`
+}
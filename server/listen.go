@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+)
+
+// UnixPrefix starts listen addresses of unix sockets, e.g. unix:/var/run/ns-api-server/api.sock
+const UnixPrefix = "unix:"
+
+// listenFDsStart is the first file descriptor passed by the service manager
+const listenFDsStart = 3
+
+// Listen returns the listener passed by the service manager with LISTEN_FDS, or a new one on the
+// unix socket or TCP address
+func Listen(address string) (net.Listener, error) {
+	listener, err := inheritedListener()
+	if err != nil || listener != nil {
+		return listener, err
+	}
+
+	if strings.HasPrefix(address, UnixPrefix) {
+		return listenUnix(strings.TrimPrefix(address, UnixPrefix))
+	}
+	return net.Listen("tcp", address)
+}
+
+// inheritedListener returns the socket opened by systemd or another service manager, that keeps it
+// open across restarts so no connection is refused
+func inheritedListener() (net.Listener, error) {
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	// variables must not reach executed commands
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if fds > 1 {
+		logs.Logs.Println("[WARNING][SERVER] " + strconv.Itoa(fds) + " sockets passed, only the first one is used")
+	}
+	syscall.CloseOnExec(listenFDsStart)
+	file := os.NewFile(listenFDsStart, "LISTEN_FD_"+strconv.Itoa(listenFDsStart))
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, err
+	}
+	logs.Logs.Println("[INFO][SERVER] listening on socket passed by service manager " + listener.Addr().String())
+	return listener, nil
+}
+
+// listenUnix creates the unix socket, replacing a stale one, with LISTEN_SOCKET_OWNER, LISTEN_SOCKET_GROUP
+// and LISTEN_SOCKET_MODE
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New(path + " exists and is not a socket")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// parse permissions before creating the socket
+	mode, err := strconv.ParseUint(configuration.Config.ListenSocketMode, 8, 32)
+	if err != nil {
+		return nil, errors.New("invalid LISTEN_SOCKET_MODE " + configuration.Config.ListenSocketMode)
+	}
+	uid, err := lookupID(configuration.Config.ListenSocketOwner, func(name string) (string, error) {
+		owner, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return owner.Uid, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	gid, err := lookupID(configuration.Config.ListenSocketGroup, func(name string) (string, error) {
+		group, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return group.Gid, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// create the socket accessible only by the owner, then set owner and group before permissions,
+	// so no other user can connect in between. The umask is process wide, it is changed only at startup
+	oldMask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, err
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Lchown(path, uid, gid); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// lookupID returns the numeric id of a user or group given by name or number, -1 when empty
+func lookupID(value string, lookup func(name string) (string, error)) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, nil
+	}
+	id, err := lookup(value)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(id)
+}
+
+// Handler makes clients of unix sockets look like loopback ones, so the client IP is read from the
+// headers of the local proxy like on TCP
+func Handler(listener net.Listener, handler http.Handler) http.Handler {
+	if listener.Addr().Network() != "unix" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = "127.0.0.1:0"
+		handler.ServeHTTP(w, r)
+	})
+}
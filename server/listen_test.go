@@ -0,0 +1,49 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	configuration.Config.ListenSocketMode = "0660"
+	configuration.Config.ListenSocketOwner = ""
+	configuration.Config.ListenSocketGroup = ""
+
+	mask := syscall.Umask(0022)
+	defer syscall.Umask(mask)
+
+	// a stale socket is replaced
+	for i := 0; i < 2; i++ {
+		listener, err := listenUnix(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0660 {
+			t.Fatalf("got mode %o, want 660", info.Mode().Perm())
+		}
+		if current := syscall.Umask(0022); current != 0022 {
+			t.Fatalf("umask not restored: %o", current)
+		}
+		if i == 0 {
+			// keep the socket file, like a crashed process
+			listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		}
+		listener.Close()
+	}
+}
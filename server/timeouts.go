@@ -0,0 +1,17 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package server
+
+import "time"
+
+// timeouts of client connections, so slow or idle clients do not hold them open. Routes with long
+// responses extend the read and write deadlines of their request
+const (
+	ReadHeaderTimeout = 10 * time.Second
+	ReadTimeout       = 60 * time.Second
+	WriteTimeout      = 60 * time.Second
+	IdleTimeout       = 120 * time.Second
+)
@@ -0,0 +1,127 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/logs"
+)
+
+// Certificate is the server certificate, loaded again when its files change on disk
+type Certificate struct {
+	certFile string
+	keyFile  string
+
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// modTimes returns the modification times of certificate and key files
+func (c *Certificate) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// LoadCertificate reads the certificate and the key, that must be valid on startup
+func LoadCertificate(certFile string, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads the certificate and the key and replaces the current ones
+func (c *Certificate) load() error {
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.certificate = &certificate
+	c.certModTime = certModTime
+	c.keyModTime = keyModTime
+	c.lock.Unlock()
+	return nil
+}
+
+// Reload reads the certificate again when its files changed, e.g. after an ACME renewal. On errors,
+// like a key not yet matching the new certificate, the current one is kept and the next reload retries
+func (c *Certificate) Reload() {
+	certModTime, keyModTime, err := c.modTimes()
+	if err != nil {
+		logs.Logs.Println("[ERR][TLS] certificate reload failed, keeping current one: " + err.Error())
+		return
+	}
+
+	c.lock.RLock()
+	changed := !certModTime.Equal(c.certModTime) || !keyModTime.Equal(c.keyModTime)
+	c.lock.RUnlock()
+	if !changed {
+		return
+	}
+
+	if err := c.load(); err != nil {
+		logs.Logs.Println("[ERR][TLS] certificate reload failed, keeping current one: " + err.Error())
+		return
+	}
+	logs.Logs.Println("[INFO][TLS] certificate " + c.certFile + " reloaded")
+}
+
+// GetCertificate returns the current certificate to the TLS handshake
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.certificate, nil
+}
+
+// TLSConfig returns the listener configuration: TLS 1.2 or later, forward secret AEAD ciphers and HTTP/2
+func TLSConfig(certificate *Certificate) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: certificate.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+		// TLS 1.3 suites are not configurable and all secure
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+
+	switch configuration.Config.TLSMinVersion {
+	case "1.2":
+		config.MinVersion = tls.VersionTLS12
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		return nil, errors.New("unsupported TLS_MIN_VERSION " + configuration.Config.TLSMinVersion)
+	}
+	return config, nil
+}
@@ -0,0 +1,185 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+var (
+	tokensBucket = []byte("tokens")
+	expiryBucket = []byte("expiry")
+)
+
+// BoltTokenStore is a TokenStore backed by an embedded bbolt database. Records are saved inside
+// the tokens bucket by id, the expiry bucket indexes them by expiration time
+type BoltTokenStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltTokenStore opens or creates the database at path
+func OpenBoltTokenStore(path string) (*BoltTokenStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	// create buckets
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tokensBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(expiryBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltTokenStore{db: db}, nil
+}
+
+// expiryKey sorts records by expiration time, then by id
+func expiryKey(record models.TokenRecord) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(record.ExpiresAt.Unix()))
+	return append(key, record.ID...)
+}
+
+func getRecord(tx *bolt.Tx, id string) (models.TokenRecord, bool, error) {
+	var record models.TokenRecord
+	value := tx.Bucket(tokensBucket).Get([]byte(id))
+	if value == nil {
+		return record, false, nil
+	}
+	err := json.Unmarshal(value, &record)
+	return record, err == nil, err
+}
+
+func deleteRecord(tx *bolt.Tx, id string) error {
+	record, found, err := getRecord(tx, id)
+	if err != nil || !found {
+		return err
+	}
+	if err := tx.Bucket(expiryBucket).Delete(expiryKey(record)); err != nil {
+		return err
+	}
+	return tx.Bucket(tokensBucket).Delete([]byte(id))
+}
+
+func (s *BoltTokenStore) Set(record models.TokenRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		// drop previous expiry index entry
+		if err := deleteRecord(tx, record.ID); err != nil {
+			return err
+		}
+		if err := tx.Bucket(tokensBucket).Put([]byte(record.ID), value); err != nil {
+			return err
+		}
+		return tx.Bucket(expiryBucket).Put(expiryKey(record), nil)
+	})
+}
+
+func (s *BoltTokenStore) Get(id string) (models.TokenRecord, bool, error) {
+	var record models.TokenRecord
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, found, err = getRecord(tx, id)
+		return err
+	})
+	return record, found, err
+}
+
+func (s *BoltTokenStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteRecord(tx, id)
+	})
+}
+
+func (s *BoltTokenStore) List(username string) ([]models.TokenRecord, error) {
+	records := []models.TokenRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).ForEach(func(_, value []byte) error {
+			var record models.TokenRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if record.Username == username {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *BoltTokenStore) DeleteUser(username string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var ids []string
+		err := tx.Bucket(tokensBucket).ForEach(func(key, value []byte) error {
+			var record models.TokenRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if record.Username == username {
+				ids = append(ids, string(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := deleteRecord(tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltTokenStore) DeleteExpired(now time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		limit := binary.BigEndian.AppendUint64(nil, uint64(now.Unix()))
+
+		// collect expired entries, the index is sorted by expiration time
+		var keys [][]byte
+		cursor := tx.Bucket(expiryBucket).Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key[:8], limit) < 0; key, _ = cursor.Next() {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+
+		for _, key := range keys {
+			if err := tx.Bucket(tokensBucket).Delete(key[8:]); err != nil {
+				return err
+			}
+			if err := tx.Bucket(expiryBucket).Delete(key); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (s *BoltTokenStore) Close() error {
+	return s.db.Close()
+}
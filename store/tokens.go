@@ -0,0 +1,44 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package store
+
+import (
+	"time"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+	"github.com/NethServer/nethsecurity-api/models"
+)
+
+// TokenStore keeps track of the valid tokens, identified by their `jti` claim
+type TokenStore interface {
+	// Set adds or replaces a token record
+	Set(record models.TokenRecord) error
+	// Get returns a token record, the boolean is false if it does not exist
+	Get(id string) (models.TokenRecord, bool, error)
+	// Delete removes a token record
+	Delete(id string) error
+	// List returns the token records of the user
+	List(username string) ([]models.TokenRecord, error)
+	// DeleteUser removes every token record of the user
+	DeleteUser(username string) error
+	// DeleteExpired removes the token records expired before the given time, returning how many were removed
+	DeleteExpired(now time.Time) (int, error)
+	// Close flushes and closes the store
+	Close() error
+}
+
+// Tokens is the token store used by the API, opened by Init
+var Tokens TokenStore
+
+// Init opens the token store configured by TOKENS_DB
+func Init() error {
+	tokens, err := OpenBoltTokenStore(configuration.Config.TokensDB)
+	if err != nil {
+		return err
+	}
+	Tokens = tokens
+	return nil
+}
@@ -6,6 +6,8 @@ SPDX-License-Identifier: GPL-2.0-only
 package sudo
 
 import (
+	"github.com/NethServer/nethsecurity-api/authenticator"
+	"github.com/NethServer/nethsecurity-api/configuration"
 	"github.com/NethServer/nethsecurity-api/methods"
 	"github.com/NethServer/nethsecurity-api/middleware"
 	"github.com/NethServer/nethsecurity-api/models"
@@ -17,6 +19,17 @@ import (
 	"net/http"
 )
 
+// passwordProvider tells if users of the provider log in with a password checked by a configured backend,
+// sessions of single sign-on and client certificates have no password to check
+func passwordProvider(provider string) bool {
+	for _, backend := range configuration.Config.AuthBackends {
+		if authenticator.Provider(backend) == provider {
+			return true
+		}
+	}
+	return false
+}
+
 type ValidationEntry struct {
 	Message   string `json:"message" structs:"message"`
 	Value     string `json:"value" structs:"value"`
@@ -35,12 +48,16 @@ type ValidationResponse struct {
 func EnableSudo(c *gin.Context) {
 	// Extract claims from JWT
 	claims := jwt.ExtractClaims(c)
-	// Get username and 2FA status from claims
+	// Get username, role and token id from claims, the sudo token keeps the same id, role and provider
 	username := claims["id"].(string)
+	role, _ := claims["role"].(string)
+	provider, _ := claims["provider"].(string)
+	jti, _ := claims["jti"].(string)
 
 	// Check if password sent is valid
 	var jsonRequest struct {
 		Password string `json:"password" structs:"password"`
+		OTP      string `json:"otp" structs:"otp"`
 	}
 	err := c.ShouldBindWith(&jsonRequest, binding.JSON)
 	if err != nil {
@@ -50,8 +67,24 @@ func EnableSudo(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	fail := methods.CheckAuthentication(username, jsonRequest.Password)
-	if fail != nil {
+	// sudo mode needs the password of the user
+	if !passwordProvider(provider) {
+		c.JSON(http.StatusForbidden, structs.Map(response.StatusForbidden{
+			Code:    http.StatusForbidden,
+			Message: "sudo mode not available",
+			Data:    provider,
+		}))
+		c.Abort()
+		return
+	}
+	// refuse attempts of locked users and clients
+	if !methods.CheckAuthLockout(c, username) {
+		return
+	}
+	// the password is checked by the backend the user logged in with
+	identity, fail := methods.CheckAuthentication(username, jsonRequest.Password)
+	if fail != nil || authenticator.Provider(identity.Backend) != provider {
+		methods.RegisterAuthFailure(username, c.ClientIP())
 		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
 			Code:    http.StatusBadRequest,
 			Message: "validation_failed",
@@ -70,9 +103,35 @@ func EnableSudo(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	token, _, err := middleware.InstanceJWT().TokenGenerator(&models.UserAuthorizations{
+	// Check OTP, if sent, to satisfy sudo rules that require a fresh one
+	if jsonRequest.OTP != "" && !methods.CheckOTP(username, jsonRequest.OTP) {
+		methods.RegisterAuthFailure(username, c.ClientIP())
+		c.JSON(http.StatusBadRequest, structs.Map(response.StatusBadRequest{
+			Code:    http.StatusBadRequest,
+			Message: "validation_failed",
+			Data: ValidationResponse{
+				ValidationBag{
+					Errors: []ValidationEntry{
+						{
+							Message:   "invalid_otp",
+							Parameter: "otp",
+							Value:     "",
+						},
+					},
+				},
+			},
+		}))
+		c.Abort()
+		return
+	}
+	methods.RegisterAuthSuccess(username)
+	token, _, err := middleware.GenerateToken(&models.UserAuthorizations{
 		Username:      username,
+		Role:          role,
+		Provider:      provider,
 		SudoRequested: true,
+		SudoOTP:       jsonRequest.OTP != "",
+		TokenID:       jti,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, structs.Map(response.StatusInternalServerError{
@@ -82,7 +141,7 @@ func EnableSudo(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	methods.SetTokenValidation(username, token)
+	methods.SetTokenValidation(username, token, c.ClientIP(), c.Request.UserAgent())
 	c.JSON(http.StatusOK, structs.Map(response.StatusOK{
 		Message: "sudo_enabled",
 		Data: struct {
@@ -0,0 +1,49 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package sudo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/NethServer/nethsecurity-api/configuration"
+)
+
+func TestEnableSudoProviders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configuration.Config.AuthBackends = []string{"local", "ldap"}
+
+	tests := []struct {
+		provider string
+		allowed  bool
+	}{
+		{"", true},
+		{"ldap", true},
+		{"radius", false},
+		{"oidc", false},
+		{"mtls", false},
+	}
+	for _, tt := range tests {
+		if got := passwordProvider(tt.provider); got != tt.allowed {
+			t.Errorf("provider %q: got %v, want %v", tt.provider, got, tt.allowed)
+		}
+	}
+
+	// single sign-on sessions are refused before any password check
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/sudo", strings.NewReader(`{"password": "secret"}`))
+	c.Set("JWT_PAYLOAD", jwt.MapClaims{"id": "oidc:alice", "role": "admin", "provider": "oidc"})
+	EnableSudo(c)
+	if recorder.Code != http.StatusForbidden || !strings.Contains(recorder.Body.String(), "sudo mode not available") {
+		t.Fatalf("got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,289 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package ubus
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// blob attribute header layout, as defined by libubox
+const (
+	blobAttrExtended = 0x80000000
+	blobAttrIDMask   = 0x7f000000
+	blobAttrIDShift  = 24
+	blobAttrLenMask  = 0x00ffffff
+	blobAttrHdrLen   = 4
+)
+
+// blobmsg data types
+const (
+	blobmsgTypeUnspec = iota
+	blobmsgTypeArray
+	blobmsgTypeTable
+	blobmsgTypeString
+	blobmsgTypeInt64
+	blobmsgTypeInt32
+	blobmsgTypeInt16
+	blobmsgTypeInt8
+	blobmsgTypeDouble
+)
+
+var errMalformedBlob = errors.New("malformed blob attribute")
+
+func blobAlign(length int) int {
+	return (length + 3) &^ 3
+}
+
+// blobAttr is a decoded blob attribute
+type blobAttr struct {
+	id       int
+	extended bool
+	data     []byte
+}
+
+// putAttr appends an attribute with the given id and payload, padded to 4 bytes
+func putAttr(buf []byte, id int, extended bool, payload []byte) []byte {
+	idLen := uint32(id<<blobAttrIDShift)&blobAttrIDMask | uint32(blobAttrHdrLen+len(payload))
+	if extended {
+		idLen |= blobAttrExtended
+	}
+	buf = binary.BigEndian.AppendUint32(buf, idLen)
+	buf = append(buf, payload...)
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func putInt32(buf []byte, id int, value uint32) []byte {
+	return putAttr(buf, id, false, binary.BigEndian.AppendUint32(nil, value))
+}
+
+func putString(buf []byte, id int, value string) []byte {
+	return putAttr(buf, id, false, append([]byte(value), 0))
+}
+
+// parseAttrs splits a buffer into the list of contained blob attributes
+func parseAttrs(buf []byte) ([]blobAttr, error) {
+	var attrs []blobAttr
+	for len(buf) > 0 {
+		if len(buf) < blobAttrHdrLen {
+			return nil, errMalformedBlob
+		}
+		idLen := binary.BigEndian.Uint32(buf)
+		length := int(idLen & blobAttrLenMask)
+		if length < blobAttrHdrLen || length > len(buf) {
+			return nil, errMalformedBlob
+		}
+		attrs = append(attrs, blobAttr{
+			id:       int((idLen & blobAttrIDMask) >> blobAttrIDShift),
+			extended: idLen&blobAttrExtended != 0,
+			data:     buf[blobAttrHdrLen:length],
+		})
+		next := blobAlign(length)
+		if next > len(buf) {
+			next = len(buf)
+		}
+		buf = buf[next:]
+	}
+	return attrs, nil
+}
+
+// putBlobmsg appends a named blobmsg attribute encoding a JSON-like value
+func putBlobmsg(buf []byte, name string, value interface{}) ([]byte, error) {
+	var kind int
+	var data []byte
+	var err error
+
+	switch v := value.(type) {
+	case nil:
+		kind = blobmsgTypeUnspec
+	case bool:
+		kind = blobmsgTypeInt8
+		data = []byte{0}
+		if v {
+			data[0] = 1
+		}
+	case string:
+		kind = blobmsgTypeString
+		data = append([]byte(v), 0)
+	case json.Number:
+		if i, errInt := v.Int64(); errInt == nil {
+			kind, data = encodeInt(i)
+		} else if f, errFloat := v.Float64(); errFloat == nil {
+			kind, data = encodeFloat(f)
+		} else {
+			return nil, fmt.Errorf("invalid number %s", v)
+		}
+	case float64:
+		kind, data = encodeFloat(v)
+	case int:
+		kind, data = encodeInt(int64(v))
+	case int64:
+		kind, data = encodeInt(v)
+	case map[string]interface{}:
+		kind = blobmsgTypeTable
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if data, err = putBlobmsg(data, key, v[key]); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		kind = blobmsgTypeArray
+		for _, item := range v {
+			if data, err = putBlobmsg(data, "", item); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+
+	// blobmsg header: name length, name and terminator, padded to 4 bytes
+	hdr := binary.BigEndian.AppendUint16(nil, uint16(len(name)))
+	hdr = append(hdr, name...)
+	hdr = append(hdr, 0)
+	for len(hdr)%4 != 0 {
+		hdr = append(hdr, 0)
+	}
+
+	return putAttr(buf, kind, true, append(hdr, data...)), nil
+}
+
+func encodeInt(i int64) (int, []byte) {
+	if i >= math.MinInt32 && i <= math.MaxInt32 {
+		return blobmsgTypeInt32, binary.BigEndian.AppendUint32(nil, uint32(int32(i)))
+	}
+	return blobmsgTypeInt64, binary.BigEndian.AppendUint64(nil, uint64(i))
+}
+
+func encodeFloat(f float64) (int, []byte) {
+	if f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64 {
+		return encodeInt(int64(f))
+	}
+	return blobmsgTypeDouble, binary.BigEndian.AppendUint64(nil, math.Float64bits(f))
+}
+
+// encodeTable encodes a JSON object as the content of a blobmsg table
+func encodeTable(payload interface{}) ([]byte, error) {
+	if payload == nil {
+		return nil, nil
+	}
+	table, ok := payload.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("payload must be an object, got %T", payload)
+	}
+
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf []byte
+	var err error
+	for _, key := range keys {
+		if buf, err = putBlobmsg(buf, key, table[key]); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// decodeBlobmsg decodes a blobmsg attribute, returning its name and value
+func decodeBlobmsg(attr blobAttr) (string, interface{}, error) {
+	if !attr.extended || len(attr.data) < 2 {
+		return "", nil, errMalformedBlob
+	}
+	nameLen := int(binary.BigEndian.Uint16(attr.data))
+	hdrLen := blobAlign(2 + nameLen + 1)
+	if hdrLen > len(attr.data) {
+		return "", nil, errMalformedBlob
+	}
+	name := string(attr.data[2 : 2+nameLen])
+	data := attr.data[hdrLen:]
+
+	switch attr.id {
+	case blobmsgTypeUnspec:
+		return name, nil, nil
+	case blobmsgTypeTable:
+		value, err := decodeTable(data)
+		return name, value, err
+	case blobmsgTypeArray:
+		attrs, err := parseAttrs(data)
+		if err != nil {
+			return "", nil, err
+		}
+		list := make([]interface{}, 0, len(attrs))
+		for _, child := range attrs {
+			_, value, err := decodeBlobmsg(child)
+			if err != nil {
+				return "", nil, err
+			}
+			list = append(list, value)
+		}
+		return name, list, nil
+	case blobmsgTypeString:
+		if n := len(data); n > 0 && data[n-1] == 0 {
+			data = data[:n-1]
+		}
+		return name, string(data), nil
+	case blobmsgTypeInt64:
+		if len(data) < 8 {
+			return "", nil, errMalformedBlob
+		}
+		return name, int64(binary.BigEndian.Uint64(data)), nil
+	case blobmsgTypeInt32:
+		if len(data) < 4 {
+			return "", nil, errMalformedBlob
+		}
+		return name, int64(int32(binary.BigEndian.Uint32(data))), nil
+	case blobmsgTypeInt16:
+		if len(data) < 2 {
+			return "", nil, errMalformedBlob
+		}
+		return name, int64(int16(binary.BigEndian.Uint16(data))), nil
+	case blobmsgTypeInt8:
+		if len(data) < 1 {
+			return "", nil, errMalformedBlob
+		}
+		return name, data[0] != 0, nil
+	case blobmsgTypeDouble:
+		if len(data) < 8 {
+			return "", nil, errMalformedBlob
+		}
+		return name, math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	}
+
+	return "", nil, fmt.Errorf("unknown blobmsg type %d", attr.id)
+}
+
+// decodeTable decodes the content of a blobmsg table into a JSON object
+func decodeTable(buf []byte) (map[string]interface{}, error) {
+	attrs, err := parseAttrs(buf)
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		name, value, err := decodeBlobmsg(attr)
+		if err != nil {
+			return nil, err
+		}
+		table[name] = value
+	}
+	return table, nil
+}
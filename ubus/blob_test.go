@@ -0,0 +1,295 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package ubus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBlobmsgRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"null", nil, nil},
+		{"true", true, true},
+		{"false", false, false},
+		{"empty string", "", ""},
+		{"string", "lan", "lan"},
+		{"string of 3 bytes", "abc", "abc"},
+		{"string of 4 bytes", "abcd", "abcd"},
+		{"string with spaces", "a b\tc", "a b\tc"},
+		{"int", 42, int64(42)},
+		{"negative int", -1, int64(-1)},
+		{"int32 bounds", int64(math.MaxInt32), int64(math.MaxInt32)},
+		{"int64", int64(math.MaxInt32) + 1, int64(math.MaxInt32) + 1},
+		{"negative int64", int64(math.MinInt64), int64(math.MinInt64)},
+		{"json integer", json.Number("1500"), int64(1500)},
+		{"json double", json.Number("1.5"), 1.5},
+		{"integral float", 3.0, int64(3)},
+		{"double", -0.25, -0.25},
+		{"empty array", []interface{}{}, []interface{}{}},
+		{"array", []interface{}{"a", 1, true, nil}, []interface{}{"a", int64(1), true, nil}},
+		{"empty table", map[string]interface{}{}, map[string]interface{}{}},
+		{
+			"nested table",
+			map[string]interface{}{
+				"interface": "wan",
+				"up":        true,
+				"route": []interface{}{
+					map[string]interface{}{"target": "0.0.0.0", "mask": 0},
+				},
+				"stats": map[string]interface{}{"rx_bytes": int64(1) << 40},
+			},
+			map[string]interface{}{
+				"interface": "wan",
+				"up":        true,
+				"route": []interface{}{
+					map[string]interface{}{"target": "0.0.0.0", "mask": int64(0)},
+				},
+				"stats": map[string]interface{}{"rx_bytes": int64(1) << 40},
+			},
+		},
+		{"nested arrays", []interface{}{[]interface{}{"a"}, []interface{}{}}, []interface{}{[]interface{}{"a"}, []interface{}{}}},
+	}
+
+	// names of every length modulo 4, to cover the padding of the header
+	names := []string{"", "a", "ab", "abc", "abcd"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range names {
+				buf, err := putBlobmsg(nil, name, tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(buf)%4 != 0 {
+					t.Fatalf("attribute of %d bytes is not aligned", len(buf))
+				}
+
+				attrs, err := parseAttrs(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(attrs) != 1 {
+					t.Fatalf("got %d attributes, want 1", len(attrs))
+				}
+				decodedName, value, err := decodeBlobmsg(attrs[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decodedName != name || !reflect.DeepEqual(value, tt.want) {
+					t.Fatalf("got %q=%#v, want %q=%#v", decodedName, value, name, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlobmsgEncoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  []byte
+	}{
+		{
+			// header 4, name length 2, name 1, terminator 1, string 3, padding 1
+			name:  "string",
+			key:   "a",
+			value: "xy",
+			want:  []byte{0x83, 0, 0, 11, 0, 1, 'a', 0, 'x', 'y', 0, 0},
+		},
+		{
+			// name padded from 5 to 8 bytes
+			name:  "int32",
+			key:   "id",
+			value: -2,
+			want:  []byte{0x85, 0, 0, 16, 0, 2, 'i', 'd', 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xfe},
+		},
+		{
+			name:  "bool",
+			key:   "up",
+			value: true,
+			want:  []byte{0x87, 0, 0, 13, 0, 2, 'u', 'p', 0, 0, 0, 0, 1, 0, 0, 0},
+		},
+		{
+			name:  "unspec",
+			key:   "",
+			value: nil,
+			want:  []byte{0x80, 0, 0, 8, 0, 0, 0, 0},
+		},
+		{
+			// array items are unnamed
+			name:  "array",
+			key:   "",
+			value: []interface{}{"b"},
+			want:  []byte{0x81, 0, 0, 20, 0, 0, 0, 0, 0x83, 0, 0, 10, 0, 0, 0, 0, 'b', 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, err := putBlobmsg(nil, tt.key, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, tt.want) {
+				t.Fatalf("got % x, want % x", buf, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeTable(t *testing.T) {
+	table := map[string]interface{}{"b": "2", "a": json.Number("1"), "c": map[string]interface{}{}}
+	buf, err := encodeTable(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keys are sorted, so the encoding is stable
+	attrs, err := parseAttrs(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, attr := range attrs {
+		name, _, err := decodeBlobmsg(attr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, name)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Fatalf("got keys %v", keys)
+	}
+
+	decoded, err := decodeTable(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"a": int64(1), "b": "2", "c": map[string]interface{}{}}; !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("got %#v, want %#v", decoded, want)
+	}
+
+	// no payload is an empty table
+	if buf, err := encodeTable(nil); err != nil || len(buf) != 0 {
+		t.Fatalf("got % x, %v", buf, err)
+	}
+
+	// payloads other than objects and values without a blobmsg type are refused
+	for _, payload := range []interface{}{
+		[]interface{}{"a"},
+		"a",
+		map[string]interface{}{"a": struct{}{}},
+		map[string]interface{}{"a": []interface{}{uint8(1)}},
+		map[string]interface{}{"a": json.Number("x")},
+	} {
+		if _, err := encodeTable(payload); err == nil {
+			t.Errorf("encodeTable(%#v) accepted", payload)
+		}
+	}
+}
+
+func TestDecodeBlobmsg(t *testing.T) {
+	// blobmsg header with the given name, for attributes built by hand
+	header := func(name string) []byte {
+		hdr := binary.BigEndian.AppendUint16(nil, uint16(len(name)))
+		hdr = append(hdr, name...)
+		hdr = append(hdr, 0)
+		for len(hdr)%4 != 0 {
+			hdr = append(hdr, 0)
+		}
+		return hdr
+	}
+
+	tests := []struct {
+		name string
+		attr blobAttr
+		want interface{}
+		err  bool
+	}{
+		{name: "int16", attr: blobAttr{id: blobmsgTypeInt16, extended: true, data: append(header("n"), 0xff, 0xfe)}, want: int64(-2)},
+		{name: "string without terminator", attr: blobAttr{id: blobmsgTypeString, extended: true, data: append(header("n"), 'a', 'b')}, want: "ab"},
+		{name: "int8 not zero", attr: blobAttr{id: blobmsgTypeInt8, extended: true, data: append(header("n"), 2)}, want: true},
+		{name: "not extended", attr: blobAttr{id: blobmsgTypeString, data: append(header("n"), 'a', 0)}, err: true},
+		{name: "short header", attr: blobAttr{id: blobmsgTypeString, extended: true, data: []byte{0}}, err: true},
+		{name: "name overflow", attr: blobAttr{id: blobmsgTypeString, extended: true, data: []byte{0, 9, 'a', 0}}, err: true},
+		{name: "short int64", attr: blobAttr{id: blobmsgTypeInt64, extended: true, data: append(header("n"), 0, 0, 0, 0)}, err: true},
+		{name: "short int32", attr: blobAttr{id: blobmsgTypeInt32, extended: true, data: append(header("n"), 0, 0)}, err: true},
+		{name: "short int16", attr: blobAttr{id: blobmsgTypeInt16, extended: true, data: append(header("n"), 0)}, err: true},
+		{name: "short int8", attr: blobAttr{id: blobmsgTypeInt8, extended: true, data: header("n")}, err: true},
+		{name: "short double", attr: blobAttr{id: blobmsgTypeDouble, extended: true, data: append(header("n"), 0)}, err: true},
+		{name: "unknown type", attr: blobAttr{id: 42, extended: true, data: header("n")}, err: true},
+		{name: "malformed array item", attr: blobAttr{id: blobmsgTypeArray, extended: true, data: append(header("n"), 0, 0)}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, value, err := decodeBlobmsg(tt.attr)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %#v, want error", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(value, tt.want) {
+				t.Fatalf("got %#v, want %#v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAttrs(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want []blobAttr
+		err  bool
+	}{
+		{name: "empty", buf: nil},
+		{
+			name: "padded attributes",
+			buf:  []byte{0x01, 0, 0, 5, 'a', 0, 0, 0, 0x82, 0, 0, 4},
+			want: []blobAttr{{id: 1, data: []byte{'a'}}, {id: 2, extended: true, data: []byte{}}},
+		},
+		{
+			// the padding of the last attribute may be missing
+			name: "unpadded last attribute",
+			buf:  []byte{0x03, 0, 0, 6, 'a', 'b'},
+			want: []blobAttr{{id: 3, data: []byte{'a', 'b'}}},
+		},
+		{name: "short header", buf: []byte{0, 0, 4}, err: true},
+		{name: "length below header", buf: []byte{0, 0, 0, 3}, err: true},
+		{name: "length beyond buffer", buf: []byte{0, 0, 0, 9, 0, 0, 0, 0}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs, err := parseAttrs(tt.buf)
+			if tt.err {
+				if !errors.Is(err, errMalformedBlob) {
+					t.Fatalf("got %v, want errMalformedBlob", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(attrs, tt.want) {
+				t.Fatalf("got %#v, want %#v", attrs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package ubus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// message types
+const (
+	msgHello = iota
+	msgStatus
+	msgData
+	msgPing
+	msgLookup
+	msgInvoke
+)
+
+// message attributes
+const (
+	attrUnspec = iota
+	attrStatus
+	attrObjPath
+	attrObjID
+	attrMethod
+	attrObjType
+	attrSignature
+	attrData
+)
+
+// status codes returned by ubusd and by the called objects
+const (
+	StatusOK = iota
+	StatusInvalidCommand
+	StatusInvalidArgument
+	StatusMethodNotFound
+	StatusNotFound
+	StatusNoData
+	StatusPermissionDenied
+	StatusTimeout
+	StatusNotSupported
+	StatusUnknownError
+	StatusConnectionFailed
+	StatusNoMemory
+	StatusParseError
+	StatusSystemError
+)
+
+var statusMessages = []string{
+	"Success",
+	"Invalid command",
+	"Invalid argument",
+	"Method not found",
+	"Not found",
+	"No response",
+	"Permission denied",
+	"Request timed out",
+	"Operation not supported",
+	"Unknown error",
+	"Connection failed",
+	"Out of memory",
+	"Parsing message data failed",
+	"System error",
+}
+
+const msgHdrLen = 8
+
+// StatusError is returned when a request ends with a status code other than StatusOK
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	if e.Code >= 0 && e.Code < len(statusMessages) {
+		return statusMessages[e.Code]
+	}
+	return fmt.Sprintf("ubus error %d", e.Code)
+}
+
+// Object describes an object returned by a lookup
+type Object struct {
+	Path    string   `json:"path"`
+	ID      uint32   `json:"id"`
+	Type    uint32   `json:"type"`
+	Methods []string `json:"methods"`
+}
+
+// Conn is a connection to ubusd
+type Conn struct {
+	conn    net.Conn
+	peer    uint32
+	seq     uint16
+	timeout time.Duration
+}
+
+type message struct {
+	msgType int
+	seq     uint16
+	peer    uint32
+	attrs   []blobAttr
+}
+
+// Dial connects to the ubusd socket, every request on the connection must end within timeout
+func Dial(socket string, timeout time.Duration) (*Conn, error) {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(conn, timeout)
+}
+
+// newConn waits for the hello message of ubusd on an open connection
+func newConn(conn net.Conn, timeout time.Duration) (*Conn, error) {
+	c := &Conn{conn: conn, timeout: timeout}
+
+	// ubusd greets every client with its peer id
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	hello, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if hello.msgType != msgHello {
+		conn.Close()
+		return nil, errors.New("unexpected ubus hello message")
+	}
+	c.peer = hello.peer
+
+	return c, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Lookup returns the object registered with the given path
+func (c *Conn) Lookup(path string) (*Object, error) {
+	var object *Object
+	err := c.request(msgLookup, 0, putString(nil, attrObjPath, path), func(attrs []blobAttr) error {
+		object = &Object{}
+		for _, attr := range attrs {
+			switch attr.id {
+			case attrObjPath:
+				object.Path = cString(attr.data)
+			case attrObjID:
+				object.ID = beUint32(attr.data)
+			case attrObjType:
+				object.Type = beUint32(attr.data)
+			case attrSignature:
+				signature, err := decodeTable(attr.data)
+				if err != nil {
+					return err
+				}
+				for method := range signature {
+					object.Methods = append(object.Methods, method)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, &StatusError{Code: StatusNotFound}
+	}
+	return object, nil
+}
+
+// Call invokes the method of the object with the given path, returning the JSON encoded reply.
+// An empty reply is returned if the method does not send any data
+func (c *Conn) Call(path string, method string, payload interface{}) ([]byte, error) {
+	object, err := c.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// payloads unmarshalled from JSON can't be sent as they are, normalize them first
+	payloadB, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payloadB))
+	decoder.UseNumber()
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	table, err := encodeTable(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	// compose invoke request
+	buf := putInt32(nil, attrObjID, object.ID)
+	buf = putString(buf, attrMethod, method)
+	buf = putAttr(buf, attrData, false, table)
+
+	var reply []byte
+	err = c.request(msgInvoke, object.ID, buf, func(attrs []blobAttr) error {
+		for _, attr := range attrs {
+			if attr.id == attrData {
+				data, err := decodeTable(attr.data)
+				if err != nil {
+					return err
+				}
+				reply, err = json.Marshal(data)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// request sends a message and collects the data replies until the final status
+func (c *Conn) request(msgType int, peer uint32, attrs []byte, onData func([]blobAttr) error) error {
+	c.seq++
+	seq := c.seq
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	// write header and attributes wrapped in a single blob
+	buf := make([]byte, msgHdrLen, msgHdrLen+blobAttrHdrLen+len(attrs))
+	buf[0] = 0
+	buf[1] = byte(msgType)
+	binary.BigEndian.PutUint16(buf[2:], seq)
+	binary.BigEndian.PutUint32(buf[4:], peer)
+	buf = putAttr(buf, 0, false, attrs)
+	if _, err := c.conn.Write(buf); err != nil {
+		return c.wrapError(err)
+	}
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return c.wrapError(err)
+		}
+
+		// skip messages of other requests
+		if msg.seq != seq {
+			continue
+		}
+
+		switch msg.msgType {
+		case msgData:
+			if err := onData(msg.attrs); err != nil {
+				return err
+			}
+		case msgStatus:
+			for _, attr := range msg.attrs {
+				if attr.id == attrStatus {
+					if status := int(int32(beUint32(attr.data))); status != StatusOK {
+						return &StatusError{Code: status}
+					}
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// read reads a whole message from the socket
+func (c *Conn) read() (*message, error) {
+	hdr := make([]byte, msgHdrLen+blobAttrHdrLen)
+	if _, err := io.ReadFull(c.conn, hdr); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint32(hdr[msgHdrLen:]) & blobAttrLenMask)
+	if length < blobAttrHdrLen {
+		return nil, errMalformedBlob
+	}
+	data := make([]byte, length-blobAttrHdrLen)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return nil, err
+	}
+
+	attrs, err := parseAttrs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &message{
+		msgType: int(hdr[1]),
+		seq:     binary.BigEndian.Uint16(hdr[2:]),
+		peer:    binary.BigEndian.Uint32(hdr[4:]),
+		attrs:   attrs,
+	}, nil
+}
+
+// wrapError converts socket timeouts to ubus timeouts
+func (c *Conn) wrapError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &StatusError{Code: StatusTimeout}
+	}
+	return err
+}
+
+// Call connects to ubusd, invokes the method and closes the connection
+func Call(socket string, timeout time.Duration, path string, method string, payload interface{}) ([]byte, error) {
+	conn, err := Dial(socket, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.Call(path, method, payload)
+}
+
+func beUint32(data []byte) uint32 {
+	if len(data) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(data)
+}
+
+func cString(data []byte) string {
+	for i, b := range data {
+		if b == 0 {
+			return string(data[:i])
+		}
+	}
+	return string(data)
+}
@@ -0,0 +1,328 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package ubus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testPeer = 0x1234
+
+// fakeObject is an object registered on the fake ubusd
+type fakeObject struct {
+	id      uint32
+	methods map[string]func(args map[string]interface{}) (map[string]interface{}, int)
+}
+
+// fakeUbusd serves lookup and invoke requests like ubusd, for the objects of the test
+type fakeUbusd struct {
+	objects map[string]fakeObject
+	// when set, replies are sent only after this delay
+	delay time.Duration
+}
+
+var testObjects = map[string]fakeObject{
+	"network.interface.wan": {
+		id: 0x100,
+		methods: map[string]func(args map[string]interface{}) (map[string]interface{}, int){
+			"status": func(args map[string]interface{}) (map[string]interface{}, int) {
+				return map[string]interface{}{"up": true, "l3_device": "eth1", "uptime": 3600, "route": []interface{}{map[string]interface{}{"target": "0.0.0.0", "mask": 0}}}, StatusOK
+			},
+			"echo": func(args map[string]interface{}) (map[string]interface{}, int) {
+				return args, StatusOK
+			},
+			"down": func(args map[string]interface{}) (map[string]interface{}, int) {
+				return nil, StatusOK
+			},
+			"fail": func(args map[string]interface{}) (map[string]interface{}, int) {
+				return nil, StatusPermissionDenied
+			},
+		},
+	},
+}
+
+// writeMessage sends a message with the given attributes wrapped in a single blob
+func writeMessage(conn io.Writer, msgType int, seq uint16, peer uint32, attrs []byte) error {
+	buf := make([]byte, msgHdrLen)
+	buf[1] = byte(msgType)
+	binary.BigEndian.PutUint16(buf[2:], seq)
+	binary.BigEndian.PutUint32(buf[4:], peer)
+	_, err := conn.Write(putAttr(buf, 0, false, attrs))
+	return err
+}
+
+func (d *fakeUbusd) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &Conn{conn: conn}
+
+	if err := writeMessage(conn, msgHello, 0, testPeer, nil); err != nil {
+		return
+	}
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return
+		}
+		if d.delay > 0 {
+			time.Sleep(d.delay)
+		}
+
+		// an unrelated message is sent before every reply, the client must skip it
+		_ = writeMessage(conn, msgData, msg.seq+100, testPeer, nil)
+
+		status := d.handle(conn, msg)
+		if err := writeMessage(conn, msgStatus, msg.seq, testPeer, putInt32(nil, attrStatus, uint32(status))); err != nil {
+			return
+		}
+	}
+}
+
+// handle replies with the data of the request, returning its status
+func (d *fakeUbusd) handle(conn net.Conn, msg *message) int {
+	switch msg.msgType {
+	case msgLookup:
+		var path string
+		for _, attr := range msg.attrs {
+			if attr.id == attrObjPath {
+				path = cString(attr.data)
+			}
+		}
+		object, ok := d.objects[path]
+		if !ok {
+			return StatusNotFound
+		}
+		signature := map[string]interface{}{}
+		for method := range object.methods {
+			signature[method] = map[string]interface{}{}
+		}
+		table, _ := encodeTable(signature)
+		buf := putString(nil, attrObjPath, path)
+		buf = putInt32(buf, attrObjID, object.id)
+		buf = putInt32(buf, attrObjType, 0x200)
+		buf = putAttr(buf, attrSignature, false, table)
+		_ = writeMessage(conn, msgData, msg.seq, testPeer, buf)
+		return StatusOK
+
+	case msgInvoke:
+		var id uint32
+		var method string
+		args := map[string]interface{}{}
+		for _, attr := range msg.attrs {
+			switch attr.id {
+			case attrObjID:
+				id = beUint32(attr.data)
+			case attrMethod:
+				method = cString(attr.data)
+			case attrData:
+				table, err := decodeTable(attr.data)
+				if err != nil {
+					return StatusInvalidArgument
+				}
+				args = table
+			}
+		}
+		for _, object := range d.objects {
+			if object.id != id || id != msg.peer {
+				continue
+			}
+			handler, ok := object.methods[method]
+			if !ok {
+				return StatusMethodNotFound
+			}
+			reply, status := handler(args)
+			if reply != nil {
+				table, _ := encodeTable(reply)
+				buf := putInt32(nil, attrObjID, id)
+				buf = putAttr(buf, attrData, false, table)
+				_ = writeMessage(conn, msgData, msg.seq, testPeer, buf)
+			}
+			return status
+		}
+		return StatusNotFound
+	}
+	return StatusInvalidCommand
+}
+
+// socketpair returns a client connection served by the fake ubusd
+func socketpair(t *testing.T, d *fakeUbusd) net.Conn {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]net.Conn, 2)
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), "ubus")
+		conns[i], err = net.FileConn(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	go d.serve(conns[1])
+	t.Cleanup(func() { conns[0].Close() })
+	return conns[0]
+}
+
+func TestLookup(t *testing.T) {
+	conn, err := newConn(socketpair(t, &fakeUbusd{objects: testObjects}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.peer != testPeer {
+		t.Fatalf("got peer %x from hello, want %x", conn.peer, testPeer)
+	}
+
+	object, err := conn.Lookup("network.interface.wan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(object.Methods)
+	want := &Object{Path: "network.interface.wan", ID: 0x100, Type: 0x200, Methods: []string{"down", "echo", "fail", "status"}}
+	if !reflect.DeepEqual(object, want) {
+		t.Fatalf("got %+v, want %+v", object, want)
+	}
+
+	// requests on the same connection use new sequence numbers
+	_, err = conn.Lookup("network.interface.lan")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != StatusNotFound {
+		t.Fatalf("got %v, want StatusNotFound", err)
+	}
+	if conn.seq != 2 {
+		t.Fatalf("got sequence %d after two requests", conn.seq)
+	}
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		method  string
+		payload interface{}
+		want    string
+		status  int
+	}{
+		{
+			name:   "reply",
+			path:   "network.interface.wan",
+			method: "status",
+			want:   `{"l3_device":"eth1","route":[{"mask":0,"target":"0.0.0.0"}],"up":true,"uptime":3600}`,
+		},
+		{
+			// payloads are normalized through JSON before being encoded
+			name:    "payload",
+			path:    "network.interface.wan",
+			method:  "echo",
+			payload: map[string]interface{}{"name": "wan", "metric": float64(10), "ratio": 0.5, "tags": []string{"a", "b"}, "opts": map[string]bool{"force": true}},
+			want:    `{"metric":10,"name":"wan","opts":{"force":true},"ratio":0.5,"tags":["a","b"]}`,
+		},
+		{
+			name:   "struct payload",
+			path:   "network.interface.wan",
+			method: "echo",
+			payload: struct {
+				Name string `json:"name"`
+			}{"wan"},
+			want: `{"name":"wan"}`,
+		},
+		{
+			name:   "no reply",
+			path:   "network.interface.wan",
+			method: "down",
+			want:   "",
+		},
+		{name: "error status", path: "network.interface.wan", method: "fail", status: StatusPermissionDenied},
+		{name: "unknown method", path: "network.interface.wan", method: "missing", status: StatusMethodNotFound},
+		{name: "unknown object", path: "network.interface.lan", method: "status", status: StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := newConn(socketpair(t, &fakeUbusd{objects: testObjects}), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reply, err := conn.Call(tt.path, tt.method, tt.payload)
+			if tt.status != StatusOK {
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.Code != tt.status {
+					t.Fatalf("got %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(reply) != tt.want {
+				t.Fatalf("got %s, want %s", reply, tt.want)
+			}
+		})
+	}
+
+	// payloads other than objects are refused before invoking
+	conn, err := newConn(socketpair(t, &fakeUbusd{objects: testObjects}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Call("network.interface.wan", "echo", []string{"a"}); err == nil {
+		t.Fatal("array payload accepted")
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	conn, err := newConn(socketpair(t, &fakeUbusd{objects: testObjects, delay: time.Second}), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Call("network.interface.wan", "status", nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != StatusTimeout {
+		t.Fatalf("got %v, want StatusTimeout", err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ubus.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		d := &fakeUbusd{objects: testObjects}
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+
+	reply, err := Call(socket, time.Second, "network.interface.wan", "echo", map[string]interface{}{"name": "wan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != `{"name":"wan"}` {
+		t.Fatalf("got %s", reply)
+	}
+
+	// missing socket
+	if _, err := Call(filepath.Join(t.TempDir(), "missing.sock"), time.Second, "network.interface.wan", "status", nil); err == nil {
+		t.Fatal("call without socket succeeded")
+	}
+}
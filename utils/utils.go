@@ -10,7 +10,9 @@
 package utils
 
 import (
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -40,3 +42,75 @@ func EpochToHumanDate(epochTime int) string {
 	tm := time.Unix(i, 0)
 	return tm.Format("2006-01-02 15:04:05")
 }
+
+// MatchPattern checks value against a glob pattern, where * matches any
+// sequence of characters (including none) and ? matches a single character
+func MatchPattern(pattern string, value string) bool {
+	matched, err := regexp.MatchString(GlobRegexp(pattern), value)
+	return err == nil && matched
+}
+
+// GlobRegexp converts a pattern with the * and ? wildcards to a regular expression matching the whole value
+func GlobRegexp(pattern string) string {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return "^" + expr + "$"
+}
+
+// MatchAction checks if one of the actions grants the requested one. Actions are
+// strings in the form <kind>:<subject>:<verb>, each part can be a glob pattern
+func MatchAction(actions []string, kind string, subject string, verb string) bool {
+	for _, action := range actions {
+		parts := strings.SplitN(action, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if MatchPattern(parts[0], kind) && MatchPattern(parts[1], subject) && MatchPattern(parts[2], verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// CoverPattern checks if every value matched by the glob pattern other is also matched by pattern
+func CoverPattern(pattern string, other string) bool {
+	// covered[i][j] reports if pattern[i:] covers other[j:]
+	covered := make([][]bool, len(pattern)+1)
+	for i := range covered {
+		covered[i] = make([]bool, len(other)+1)
+	}
+	covered[len(pattern)][len(other)] = true
+
+	for i := len(pattern) - 1; i >= 0; i-- {
+		for j := len(other); j >= 0; j-- {
+			switch {
+			case pattern[i] == '*':
+				// the wildcard takes none or one more character or wildcard of other
+				covered[i][j] = covered[i+1][j] || (j < len(other) && covered[i][j+1])
+			case j == len(other) || other[j] == '*':
+				covered[i][j] = false
+			case other[j] == '?':
+				covered[i][j] = pattern[i] == '?' && covered[i+1][j+1]
+			default:
+				covered[i][j] = (pattern[i] == '?' || pattern[i] == other[j]) && covered[i+1][j+1]
+			}
+		}
+	}
+	return covered[0][0]
+}
+
+// CoverAction checks if one of the actions grants every action matched by the requested one,
+// whose subject and verb can be glob patterns
+func CoverAction(actions []string, kind string, subject string, verb string) bool {
+	for _, action := range actions {
+		parts := strings.SplitN(action, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if MatchPattern(parts[0], kind) && CoverPattern(parts[1], subject) && CoverPattern(parts[2], verb) {
+			return true
+		}
+	}
+	return false
+}
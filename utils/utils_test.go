@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2025 Nethesis S.r.l.
+SPDX-License-Identifier: GPL-2.0-only
+*/
+
+package utils
+
+import "testing"
+
+func TestCoverPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		other   string
+		covered bool
+	}{
+		{"network.interface", "network.interface", true},
+		{"network.interface", "network.interfaces", false},
+		{"*", "*", true},
+		{"*", "network.*", true},
+		{"*", "", true},
+		{"network.*", "network.interface.*", true},
+		{"network.*", "network.*", true},
+		{"network.*", "*", false},
+		{"network.interface.*", "network.*", false},
+		{"network.*.status", "network.*.status", true},
+		{"network.*.status", "network.*", false},
+		{"*.status", "network.*.status", true},
+		{"get?", "get?", true},
+		{"get?", "get*", false},
+		{"get*", "get?", true},
+		{"get*", "?et", false},
+		{"?et", "get", true},
+		{"?et", "?et", true},
+		{"a?c", "a*c", false},
+		{"a**", "ab*", true},
+	}
+	for _, tt := range tests {
+		if covered := CoverPattern(tt.pattern, tt.other); covered != tt.covered {
+			t.Errorf("CoverPattern(%q, %q) = %v, want %v", tt.pattern, tt.other, covered, tt.covered)
+		}
+	}
+}
+
+func TestCoverAction(t *testing.T) {
+	actions := []string{"ubus:network.interface.*:status", "route:*:GET", "invalid"}
+
+	if !CoverAction(actions, "ubus", "network.interface.lan", "status") {
+		t.Error("granted call not covered")
+	}
+	if CoverAction(actions, "ubus", "network.interface.lan", "*") {
+		t.Error("every method covered by a single one")
+	}
+	if CoverAction(actions, "ubus", "*", "GET") {
+		t.Error("action of other kind covers ubus")
+	}
+	if !CoverAction([]string{"*:*:*"}, "ubus", "*", "*") {
+		t.Error("admin action does not cover everything")
+	}
+}